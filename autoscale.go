@@ -0,0 +1,148 @@
+package channels
+
+import "time"
+
+// AutoscalePolicy configures automatic capacity tuning for a ResizableChannel (see SetAutoscale). Every Interval
+// the channel looks at how long writers spent blocked on its full buffer and how long the buffer spent empty (so
+// that readers would sit idle), and doubles or halves its capacity accordingly, within the given bounds. A full
+// buffer which no writer is waiting on doesn't count; a writer's wait is counted once it is let in, or at the end
+// of the interval if that would decide whether to grow, in which case the writer is let in to find out.
+type AutoscalePolicy struct {
+	Min, Max BufferCap     // Bounds on the capacity. Min may be None; Max may be Infinity, meaning no upper bound.
+	Interval time.Duration // How often to evaluate the capacity.
+
+	// Grow doubles the capacity when writers were blocked for more than this fraction of the interval, which must
+	// be greater than 0 and at most 1.
+	Grow float64
+	// Shrink halves the capacity when the buffer was empty for more than this fraction of the interval, which must
+	// be greater than 0 and at most 1.
+	Shrink float64
+
+	// Events, if not nil, receives a CapacityChange each time the capacity is changed. Sends do not block;
+	// if Events is not ready to receive, the event is dropped.
+	Events chan<- CapacityChange
+}
+
+// CapacityChange is sent on AutoscalePolicy.Events when a ResizableChannel is automatically resized.
+type CapacityChange struct {
+	Old, New BufferCap
+}
+
+func (policy *AutoscalePolicy) validate() {
+	if policy.Min < 0 || (policy.Max < 0 && policy.Max != Infinity) || (policy.Max != Infinity && policy.Max < policy.Min) {
+		panic("channels: invalid capacity bounds in AutoscalePolicy")
+	}
+	if policy.Interval <= 0 {
+		panic("channels: invalid interval in AutoscalePolicy")
+	}
+	if policy.Grow <= 0 || policy.Grow > 1 || policy.Shrink <= 0 || policy.Shrink > 1 {
+		panic("channels: invalid Grow or Shrink fraction in AutoscalePolicy")
+	}
+}
+
+// autoscaler tracks the state of a ResizableChannel's buffer on behalf of its goroutine.
+type autoscaler struct {
+	policy      AutoscalePolicy
+	ticker      *time.Ticker
+	empty       bool
+	since       time.Time
+	blockedTime time.Duration
+	emptyTime   time.Duration
+	started     time.Time
+}
+
+func newAutoscaler(policy AutoscalePolicy) *autoscaler {
+	now := time.Now()
+	return &autoscaler{
+		policy:  policy,
+		ticker:  time.NewTicker(policy.Interval),
+		since:   now,
+		started: now,
+	}
+}
+
+func (a *autoscaler) stop() {
+	a.ticker.Stop()
+}
+
+// observe records whether the buffer is empty after each operation.
+func (a *autoscaler) observe(now time.Time, empty bool) {
+	if empty == a.empty {
+		return
+	}
+	a.accumulate(now)
+	a.empty = empty
+}
+
+func (a *autoscaler) accumulate(now time.Time) {
+	if a.empty {
+		a.emptyTime += now.Sub(a.since)
+	}
+	a.since = now
+}
+
+// blocked records that a writer was kept waiting on the full buffer from since until now. Only the part of the
+// wait within the current interval is counted.
+func (a *autoscaler) blocked(since, now time.Time) {
+	if since.Before(a.started) {
+		since = a.started
+	}
+	a.blockedTime += now.Sub(since)
+}
+
+// evaluate decides on the new capacity at the end of an interval, and resets for the next one. If the input has
+// been blocked since blockedSince (which is zero if it isn't blocked) and counting that would make the capacity
+// grow, admit is called with the grown capacity to find out whether a writer is in fact waiting. It returns true
+// only if it took a value from one, which the caller must then buffer.
+func (a *autoscaler) evaluate(now time.Time, size BufferCap, blockedSince time.Time, admit func(BufferCap) bool) BufferCap {
+	a.accumulate(now)
+	elapsed := now.Sub(a.started)
+	blockedFraction := float64(a.blockedTime) / float64(elapsed)
+	pendingFraction := blockedFraction
+	if !blockedSince.IsZero() {
+		if blockedSince.Before(a.started) {
+			blockedSince = a.started
+		}
+		pendingFraction += float64(now.Sub(blockedSince)) / float64(elapsed)
+	}
+	emptyFraction := float64(a.emptyTime) / float64(elapsed)
+	a.blockedTime, a.emptyTime, a.started = 0, 0, now
+
+	newSize := size
+	switch {
+	case size == Infinity:
+		newSize = a.policy.Max
+	case elapsed <= 0:
+	case blockedFraction > a.policy.Grow:
+		newSize = a.grown(size)
+	case pendingFraction > a.policy.Grow && admit != nil && admit(a.grown(size)):
+		newSize = a.grown(size)
+	case emptyFraction > a.policy.Shrink:
+		newSize = size / 2
+	}
+
+	if newSize < a.policy.Min && newSize != Infinity {
+		newSize = a.policy.Min
+	}
+	if a.policy.Max != Infinity && (newSize > a.policy.Max || newSize == Infinity) {
+		newSize = a.policy.Max
+	}
+
+	if newSize != size && a.policy.Events != nil {
+		select {
+		case a.policy.Events <- CapacityChange{Old: size, New: newSize}:
+		default:
+		}
+	}
+	return newSize
+}
+
+func (a *autoscaler) grown(size BufferCap) BufferCap {
+	if size == None {
+		return 1
+	}
+	if a.policy.Max != Infinity && size*2 > a.policy.Max {
+		return a.policy.Max
+	}
+	return size * 2
+}
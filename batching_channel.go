@@ -1,13 +1,24 @@
 package channels
 
+import (
+	"context"
+	"sync/atomic"
+)
+
 // BatchingChannel implements the Channel interface, with the change that instead of producing individual elements
 // on Out(), it batches together the entire internal buffer each time. Trying to construct an unbuffered batching channel
 // will panic, that configuration is not supported (and provides no benefit over an unbuffered NativeChannel).
+// As with PolicyChannel, Len() is updated by the channel's goroutine and so may briefly lag behind a write or read.
 type BatchingChannel struct {
+	length        lengthGauge
+	metrics       metricsHook
+	goroutine     int64 // accessed atomically
 	input, output chan interface{}
-	length        chan int
 	buffer        []interface{}
 	size          BufferCap
+	requests      chan interface{} // contentsRequest or identifyRequest
+	done          chan struct{}
+	closer        closeState
 }
 
 func NewBatchingChannel(size BufferCap) *BatchingChannel {
@@ -18,10 +29,11 @@ func NewBatchingChannel(size BufferCap) *BatchingChannel {
 		panic("channels: invalid negative size in NewBatchingChannel")
 	}
 	ch := &BatchingChannel{
-		input:  make(chan interface{}),
-		output: make(chan interface{}),
-		length: make(chan int),
-		size:   size,
+		input:    make(chan interface{}),
+		output:   make(chan interface{}),
+		done:     make(chan struct{}),
+		requests: make(chan interface{}),
+		size:     size,
 	}
 	go ch.batchingBuffer()
 	return ch
@@ -40,7 +52,7 @@ func (ch *BatchingChannel) Out() <-chan interface{} {
 }
 
 func (ch *BatchingChannel) Len() int {
-	return <-ch.length
+	return ch.length.get()
 }
 
 func (ch *BatchingChannel) Cap() BufferCap {
@@ -48,11 +60,58 @@ func (ch *BatchingChannel) Cap() BufferCap {
 }
 
 func (ch *BatchingChannel) Close() {
-	close(ch.input)
+	ch.closer.close(ch.input, nil)
+}
+
+func (ch *BatchingChannel) CloseWithError(err error) {
+	ch.closer.close(ch.input, err)
+}
+
+func (ch *BatchingChannel) Err() error {
+	return ch.closer.error()
+}
+
+func (ch *BatchingChannel) Done() <-chan struct{} {
+	return ch.done
+}
+
+func (ch *BatchingChannel) CloseAndWait(ctx context.Context) error {
+	return closeAndWait(ctx, ch, ch.done)
+}
+
+func (ch *BatchingChannel) Snapshot() []interface{} {
+	return requestContents(ch.requests, ch.done, false)
+}
+
+func (ch *BatchingChannel) Drain() []interface{} {
+	return requestContents(ch.requests, ch.done, true)
+}
+
+func (ch *BatchingChannel) SetWatermarks(marks *Watermarks) {
+	ch.length.watch(marks)
+}
+
+func (ch *BatchingChannel) SetMetrics(m Metrics) {
+	ch.metrics.set(m)
+}
+
+func (ch *BatchingChannel) inspect() inspection {
+	read, dropped := ch.metrics.totals()
+	return inspection{
+		closed:    ch.closer.isClosed(),
+		read:      read,
+		dropped:   dropped,
+		goroutine: atomic.LoadInt64(&ch.goroutine),
+	}
+}
+
+func (ch *BatchingChannel) identify() {
+	requestIdentify(ch.requests, ch.done)
 }
 
 func (ch *BatchingChannel) batchingBuffer() {
 	var input, output, nextInput chan interface{}
+	var blocking blockTimer
 	nextInput = ch.input
 	input = nextInput
 
@@ -61,27 +120,55 @@ func (ch *BatchingChannel) batchingBuffer() {
 		case elem, open := <-input:
 			if open {
 				ch.buffer = append(ch.buffer, elem)
+				ch.metrics.enqueued(1)
 			} else {
 				input = nil
 				nextInput = nil
 			}
 		case output <- ch.buffer:
+			ch.metrics.dequeued(len(ch.buffer))
 			ch.buffer = nil
-		case ch.length <- len(ch.buffer):
+		case req := <-ch.requests:
+			switch req := req.(type) {
+			case contentsRequest:
+				contents := append([]interface{}(nil), ch.buffer...)
+				if req.drain {
+					ch.metrics.dequeued(len(ch.buffer))
+					ch.buffer = nil
+					ch.metrics.setLength(&ch.length, 0)
+				}
+				req.reply <- contents
+			case identifyRequest:
+				atomic.StoreInt64(&ch.goroutine, goroutineID())
+			}
 		}
 
-		if len(ch.buffer) == 0 {
-			input = nextInput
-			output = nil
-		} else if ch.size != Infinity && len(ch.buffer) >= int(ch.size) {
-			input = nil
-			output = ch.output
-		} else {
-			input = nextInput
-			output = ch.output
+		for {
+			if len(ch.buffer) == 0 {
+				input = nextInput
+				output = nil
+			} else if ch.size != Infinity && len(ch.buffer) >= int(ch.size) {
+				input = nil
+				output = ch.output
+			} else {
+				input = nextInput
+				output = ch.output
+			}
+			elem, received, open := blocking.update(input, input == nil && nextInput != nil, &ch.metrics)
+			if !received {
+				break
+			}
+			// a writer was left waiting while the buffer was full
+			if open {
+				ch.buffer = append(ch.buffer, elem)
+				ch.metrics.enqueued(1)
+			} else {
+				nextInput = nil
+			}
 		}
+		ch.metrics.setLength(&ch.length, len(ch.buffer))
 	}
 
 	close(ch.output)
-	close(ch.length)
+	close(ch.done)
 }
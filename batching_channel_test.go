@@ -43,3 +43,21 @@ func TestBatchingChannelCap(t *testing.T) {
 		t.Error("incorrect capacity on infinite channel")
 	}
 }
+
+func BenchmarkBatchingChannelSerial(b *testing.B) {
+	ch := NewBatchingChannel(Infinity)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+	}
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+}
+
+func BenchmarkBatchingChannelTickTock(b *testing.B) {
+	ch := NewBatchingChannel(Infinity)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+		<-ch.Out()
+	}
+}
@@ -3,16 +3,21 @@ package channels
 // BlackHole implements the InChannel interface and provides an analogue for the "Discard" variable in
 // the ioutil package - it never blocks, and simply discards every value it reads. The number of items
 // discarded in this way is counted and returned from Len.
+//
+// The count is kept by the BlackHole's goroutine, so Len may briefly lag behind a write which has just completed.
+// To make the final count exact, Close (and CloseWithError) wait for the goroutine to count every value already
+// written before returning; unlike closing the other types, this can block for as long as any write in progress.
 type BlackHole struct {
+	count  lengthGauge
 	input  chan interface{}
-	length chan int
-	count  int
+	done   chan struct{}
+	closer closeState
 }
 
 func NewBlackHole() *BlackHole {
 	ch := &BlackHole{
-		input:  make(chan interface{}),
-		length: make(chan int),
+		input: make(chan interface{}),
+		done:  make(chan struct{}),
 	}
 	go ch.discard()
 	return ch
@@ -23,32 +28,32 @@ func (ch *BlackHole) In() chan<- interface{} {
 }
 
 func (ch *BlackHole) Len() int {
-	val, open := <-ch.length
-	if open {
-		return val
-	} else {
-		return ch.count
-	}
+	return ch.count.get()
 }
 
 func (ch *BlackHole) Cap() BufferCap {
 	return Infinity
 }
 
+// Close closes the BlackHole, waiting until every value already written has been counted by Len.
 func (ch *BlackHole) Close() {
-	close(ch.input)
+	ch.CloseWithError(nil)
+}
+
+func (ch *BlackHole) CloseWithError(err error) {
+	ch.closer.close(ch.input, err)
+	<-ch.done
+}
+
+func (ch *BlackHole) Err() error {
+	return ch.closer.error()
 }
 
 func (ch *BlackHole) discard() {
-	for {
-		select {
-		case _, open := <-ch.input:
-			if !open {
-				close(ch.length)
-				return
-			}
-			ch.count++
-		case ch.length <- ch.count:
-		}
+	count := 0
+	for _ = range ch.input {
+		count++
+		ch.count.set(count)
 	}
+	close(ch.done)
 }
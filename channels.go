@@ -10,16 +10,18 @@ interest is Channel, though sub-interfaces are also provided for cases where the
 cannot be met (for example, InChannel for write-only channels).
 
 For integration with native typed golang channels, functions Wrap and Unwrap are provided which do the
-appropriate type conversions. The NativeChannel, NativeInChannel and NativeOutChannel type definitions
+appropriate type conversions (on Go 1.18 or later, the generic WrapOf and UnwrapTo do the same without
+reflection). The NativeChannel, NativeInChannel and NativeOutChannel type definitions
 are also provided for use with native channels which already carry values of type interface{}.
 
 The heart of the package consists of several distinct implementations of the Channel interface, including
-channels backed by special buffers (resizable, infinite, ring buffers, etc) and other useful types. A
+channels backed by special buffers (resizable, infinite, ring buffers, etc) and other useful types. Most of the
+buffered types are presets of PolicyChannel, whose Storage and overflow Policy can be mixed freely. A
 "black hole" channel for discarding unwanted values (similar in purpose to ioutil.Discard or /dev/null)
 rounds out the set.
 
 Helper functions for operating on Channels include Pipe and Tee (which behave much like their Unix
-namesakes), as well as Multiplex and Distribute. "Weak" versions of these functions also exist, which
+namesakes), as well as Multiplex, MergeSorted and Distribute. "Weak" versions of these functions also exist, which
 do not close their output channel(s) on completion.
 
 Due to limitations of Go's type system, importing this library directly is often not practical for
@@ -31,13 +33,17 @@ Warning: several types in this package provide so-called "infinite" buffers. Be
 these, as no buffer is truly infinite - if such a buffer grows too large your program will run out of
 memory and crash. Caveat emptor.
 
-Warning: the channel types from this package are implemented by spawning goroutines. If a channel from
-this package passes out of scope without being explicitly emptied and closed, it will leak the
-goroutine and remaining values.
+Warning: most of the channel types from this package are implemented by spawning goroutines. If a channel
+from this package passes out of scope without being explicitly emptied and closed, it will leak the
+goroutine and remaining values. LockedChannel is the exception: it only spawns goroutines if its In() or
+Out() methods are used.
 */
 package channels
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 // BufferCap represents the capacity of the buffer backing a channel. Valid values consist of all
 // positive integers, as well as the special values below.
@@ -52,6 +58,12 @@ const (
 
 // Buffer is an interface for any channel that provides access to query the state of its buffer.
 // Even unbuffered channels can implement this interface by simply returning 0 from Len() and None from Cap().
+//
+// For every implementation in this package, Len() counts the values which have been written to In() and not
+// yet read from Out(), including the value (or, for BatchingChannel, the batch of values) that is waiting to be
+// read; BatchingChannel counts individual values, not batches. Neither Len() nor Cap() ever blocks. Since the
+// buffer is managed concurrently the result is only a snapshot, and for the goroutine-backed types it is
+// updated just after each write or read completes, so it may briefly lag behind them.
 type Buffer interface {
 	Len() int       // The number of elements currently buffered.
 	Cap() BufferCap // The maximum number of elements that can be buffered.
@@ -64,12 +76,39 @@ type SimpleInChannel interface {
 	Close()                 // Closes the channel. It is an error to write to In() after calling Close().
 }
 
+// ErrorCloser is an interface representing a channel which can be closed with an error explaining why. The
+// error is made available to readers (typically once they see Out() close) via Err(). All of the goroutine-backed
+// channel types in this package implement it; for all types in this package Close itself is idempotent.
+type ErrorCloser interface {
+	CloseWithError(err error) // Closes the channel as Close() does, recording err. Only the first close takes effect.
+	Err() error               // The error passed to CloseWithError, or nil if the channel is open or was closed by Close.
+}
+
 // InChannel is an interface representing a writeable channel with a buffer.
 type InChannel interface {
 	SimpleInChannel
 	Buffer
 }
 
+// Drainer is an interface representing a buffered channel which can signal when it has been closed and every
+// value remaining in its buffer has been delivered to a reader.
+type Drainer interface {
+	Done() <-chan struct{}                  // Closed once the channel has been closed and its buffer fully drained.
+	CloseAndWait(ctx context.Context) error // Closes the channel and waits for Done, returning ctx.Err() if ctx finishes first.
+}
+
+// Snapshotter is an interface representing a buffered channel whose buffer contents can be inspected.
+type Snapshotter interface {
+	Snapshot() []interface{} // A copy of the buffered values, in the order they would be read, without removing them.
+	Drain() []interface{}    // Atomically removes and returns all buffered values, in the order they would be read.
+}
+
+// Watermarker is an interface representing a buffered channel which can report when its buffer fills past a
+// high watermark and drains back below a low one. Every buffered type in this package implements it.
+type Watermarker interface {
+	SetWatermarks(marks *Watermarks) // Replaces the channel's watermarks (nil removes them). Panics if they are invalid.
+}
+
 // SimpleOutChannel is an interface representing a readable channel that does not necessarily
 // implement the Buffer interface.
 type SimpleOutChannel interface {
@@ -105,7 +144,52 @@ func pipe(input SimpleOutChannel, output SimpleInChannel, closeWhenDone bool) {
 	}
 }
 
+// maxNativeFan is the largest number of inputs (for multiplex) or outputs (for tee and distribute) that
+// are handled with a native select statement; beyond that we fall back to reflect.Select, which is
+// considerably slower per value but handles any number of cases.
+const maxNativeFan = 4
+
 func multiplex(output SimpleInChannel, inputs []SimpleOutChannel, closeWhenDone bool) {
+	if len(inputs) <= maxNativeFan {
+		multiplexNative(output, inputs)
+	} else {
+		multiplexReflect(output, inputs)
+	}
+	if closeWhenDone {
+		output.Close()
+	}
+}
+
+func multiplexNative(output SimpleInChannel, inputs []SimpleOutChannel) {
+	// unused cases are left as nil channels, which are never ready
+	var in [maxNativeFan]<-chan interface{}
+	for i := range inputs {
+		in[i] = inputs[i].Out()
+	}
+	for inputCount := len(inputs); inputCount > 0; {
+		var elem interface{}
+		var open bool
+		var chosen int
+		select {
+		case elem, open = <-in[0]:
+			chosen = 0
+		case elem, open = <-in[1]:
+			chosen = 1
+		case elem, open = <-in[2]:
+			chosen = 2
+		case elem, open = <-in[3]:
+			chosen = 3
+		}
+		if open {
+			output.In() <- elem
+		} else {
+			in[chosen] = nil
+			inputCount--
+		}
+	}
+}
+
+func multiplexReflect(output SimpleInChannel, inputs []SimpleOutChannel) {
 	inputCount := len(inputs)
 	cases := make([]reflect.SelectCase, inputCount)
 	for i := range cases {
@@ -121,26 +205,102 @@ func multiplex(output SimpleInChannel, inputs []SimpleOutChannel, closeWhenDone
 			inputCount--
 		}
 	}
+}
+
+func mergeSorted(output SimpleInChannel, less func(a, b interface{}) bool, inputs []SimpleOutChannel, closeWhenDone bool) {
+	heads := make([]interface{}, len(inputs))
+	ready := make([]bool, len(inputs))
+	open := make([]bool, len(inputs))
+	for i := range open {
+		open[i] = true
+	}
+	for {
+		// we can only emit once every open input has a value waiting, since a slow input
+		// may still produce something smaller than everything we've seen so far
+		for i := range inputs {
+			if open[i] && !ready[i] {
+				heads[i], open[i] = <-inputs[i].Out()
+				ready[i] = open[i]
+			}
+		}
+		min := -1
+		for i := range heads {
+			if ready[i] && (min < 0 || less(heads[i], heads[min])) {
+				min = i
+			}
+		}
+		if min < 0 {
+			break
+		}
+		output.In() <- heads[min]
+		heads[min] = nil
+		ready[min] = false
+	}
 	if closeWhenDone {
 		output.Close()
 	}
 }
 
 func tee(input SimpleOutChannel, outputs []SimpleInChannel, closeWhenDone bool) {
+	if len(outputs) <= maxNativeFan {
+		teeNative(input, outputs)
+	} else {
+		teeReflect(input, outputs)
+	}
+	if closeWhenDone {
+		for i := range outputs {
+			outputs[i].Close()
+		}
+	}
+}
+
+func teeNative(input SimpleOutChannel, outputs []SimpleInChannel) {
+	for elem := range input.Out() {
+		// unused cases are left as nil channels, which are never ready
+		var out [maxNativeFan]chan<- interface{}
+		for i := range outputs {
+			out[i] = outputs[i].In()
+		}
+		for _ = range outputs {
+			select {
+			case out[0] <- elem:
+				out[0] = nil
+			case out[1] <- elem:
+				out[1] = nil
+			case out[2] <- elem:
+				out[2] = nil
+			case out[3] <- elem:
+				out[3] = nil
+			}
+		}
+	}
+}
+
+func teeReflect(input SimpleOutChannel, outputs []SimpleInChannel) {
 	cases := make([]reflect.SelectCase, len(outputs))
 	for i := range cases {
 		cases[i].Dir = reflect.SelectSend
 	}
 	for elem := range input.Out() {
+		// going via a pointer gives us a valid Value even when elem is nil
+		send := reflect.ValueOf(&elem).Elem()
 		for i := range cases {
 			cases[i].Chan = reflect.ValueOf(outputs[i].In())
-			cases[i].Send = reflect.ValueOf(elem)
+			cases[i].Send = send
 		}
 		for _ = range cases {
 			chosen, _, _ := reflect.Select(cases)
 			cases[chosen].Chan = reflect.ValueOf(nil)
 		}
 	}
+}
+
+func distribute(input SimpleOutChannel, outputs []SimpleInChannel, closeWhenDone bool) {
+	if len(outputs) <= maxNativeFan {
+		distributeNative(input, outputs)
+	} else {
+		distributeReflect(input, outputs)
+	}
 	if closeWhenDone {
 		for i := range outputs {
 			outputs[i].Close()
@@ -148,23 +308,36 @@ func tee(input SimpleOutChannel, outputs []SimpleInChannel, closeWhenDone bool)
 	}
 }
 
-func distribute(input SimpleOutChannel, outputs []SimpleInChannel, closeWhenDone bool) {
+func distributeNative(input SimpleOutChannel, outputs []SimpleInChannel) {
+	// unused cases are left as nil channels, which are never ready
+	var out [maxNativeFan]chan<- interface{}
+	for i := range outputs {
+		out[i] = outputs[i].In()
+	}
+	for elem := range input.Out() {
+		select {
+		case out[0] <- elem:
+		case out[1] <- elem:
+		case out[2] <- elem:
+		case out[3] <- elem:
+		}
+	}
+}
+
+func distributeReflect(input SimpleOutChannel, outputs []SimpleInChannel) {
 	cases := make([]reflect.SelectCase, len(outputs))
 	for i := range cases {
 		cases[i].Dir = reflect.SelectSend
 		cases[i].Chan = reflect.ValueOf(outputs[i].In())
 	}
 	for elem := range input.Out() {
+		// going via a pointer gives us a valid Value even when elem is nil
+		send := reflect.ValueOf(&elem).Elem()
 		for i := range cases {
-			cases[i].Send = reflect.ValueOf(elem)
+			cases[i].Send = send
 		}
 		reflect.Select(cases)
 	}
-	if closeWhenDone {
-		for i := range outputs {
-			outputs[i].Close()
-		}
-	}
 }
 
 // Pipe connects the input channel to the output channel so that
@@ -175,7 +348,7 @@ func Pipe(input SimpleOutChannel, output SimpleInChannel) {
 
 // Multiplex takes an arbitrary number of input channels and multiplexes their output into a single output
 // channel. When all input channels have been closed, the output channel is closed. Multiplex with a single
-// input channel is equivalent to Pipe (though slightly less efficient).
+// input channel is equivalent to Pipe.
 func Multiplex(output SimpleInChannel, inputs ...SimpleOutChannel) {
 	if len(inputs) == 0 {
 		panic("channels: Multiplex requires at least one input")
@@ -183,6 +356,19 @@ func Multiplex(output SimpleInChannel, inputs ...SimpleOutChannel) {
 	go multiplex(output, inputs, true)
 }
 
+// MergeSorted takes an arbitrary number of input channels, each of which must produce values in the order
+// defined by less, and merges them into a single output channel which is also in that order (a k-way merge).
+// Values which compare equal are emitted in the order of the inputs they came from. Since a value cannot be
+// emitted until every open input has a value ready to compare it against, a slow input will hold up the
+// output; inputs which are closed (including those which are already closed) simply drop out of the merge.
+// When all input channels have been closed, the output channel is closed.
+func MergeSorted(output SimpleInChannel, less func(a, b interface{}) bool, inputs ...SimpleOutChannel) {
+	if len(inputs) == 0 {
+		panic("channels: MergeSorted requires at least one input")
+	}
+	go mergeSorted(output, less, inputs, true)
+}
+
 // Tee (like its Unix namesake) takes a single input channel and an arbitrary number of output channels
 // and duplicates each input into every output. When the input channel is closed, all outputs channels are closed.
 // Tee with a single output channel is equivalent to Pipe (though slightly less efficient).
@@ -219,6 +405,15 @@ func WeakMultiplex(output SimpleInChannel, inputs ...SimpleOutChannel) {
 	go multiplex(output, inputs, false)
 }
 
+// WeakMergeSorted behaves like MergeSorted (merging multiple sorted inputs into a single sorted output) except
+// that it does not close the output channel when the input channels are closed.
+func WeakMergeSorted(output SimpleInChannel, less func(a, b interface{}) bool, inputs ...SimpleOutChannel) {
+	if len(inputs) == 0 {
+		panic("channels: WeakMergeSorted requires at least one input")
+	}
+	go mergeSorted(output, less, inputs, false)
+}
+
 // WeakTee behaves like Tee (duplicating a single input into multiple outputs) except that it does not close
 // the output channels when the input channel is closed.
 func WeakTee(input SimpleOutChannel, outputs ...SimpleInChannel) {
@@ -288,3 +483,78 @@ func Unwrap(input SimpleOutChannel, output interface{}) {
 		}
 	}()
 }
+
+// UnwrapConvert behaves like Unwrap, except that each value received is first passed through convert (which
+// may be nil, to use values as they are). Rather than panicking, values for which convert returns an error, or
+// whose converted form cannot be sent on the output channel's element type, are written in their original form
+// to deadLetter (or discarded, if deadLetter is nil). The output channel is closed when the input is closed, but
+// deadLetter is not. It panics if the output is not a writable channel.
+func UnwrapConvert(input SimpleOutChannel, output interface{}, convert func(interface{}) (interface{}, error), deadLetter SimpleInChannel) {
+	t := reflect.TypeOf(output)
+	if t.Kind() != reflect.Chan || t.ChanDir()&reflect.SendDir == 0 {
+		panic("channels: output of UnwrapConvert must be writable channel")
+	}
+
+	go func() {
+		v := reflect.ValueOf(output)
+		for x := range input.Out() {
+			converted := x
+			var err error
+			if convert != nil {
+				converted, err = convert(x)
+			}
+			if val, ok := sendableValue(converted, t.Elem()); ok && err == nil {
+				v.Send(val)
+			} else if deadLetter != nil {
+				deadLetter.In() <- x
+			}
+		}
+		v.Close()
+	}()
+}
+
+// sendableValue returns x as a reflect.Value which can be sent on a channel of element type elem, if possible.
+func sendableValue(x interface{}, elem reflect.Type) (reflect.Value, bool) {
+	if x == nil {
+		switch elem.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+			return reflect.Zero(elem), true
+		}
+		return reflect.Value{}, false
+	}
+	val := reflect.ValueOf(x)
+	return val, val.Type().AssignableTo(elem)
+}
+
+// WrapIn is the counterpart to Wrap: it takes any writable channel type (chan or chan<- but not <-chan) and
+// exposes it as a SimpleInChannel. Values written to In() are passed on using Unwrap, so the same caveats apply;
+// in particular writing a value that cannot be sent on the wrapped channel will panic (use UnwrapConvert on a
+// NativeChannel to divert such values instead). Closing the SimpleInChannel closes the wrapped channel.
+// It panics if the input is not a writable channel.
+func WrapIn(ch interface{}) SimpleInChannel {
+	t := reflect.TypeOf(ch)
+	if t.Kind() != reflect.Chan || t.ChanDir()&reflect.SendDir == 0 {
+		panic("channels: input to WrapIn must be writable channel")
+	}
+	realChan := make(chan interface{})
+	Unwrap(NativeOutChannel(realChan), ch)
+	return NativeInChannel(realChan)
+}
+
+// spillover passes a value displaced from a channel's buffer on to the spill channel, if there is one.
+func spillover(spill SimpleInChannel, elem interface{}) {
+	if spill != nil {
+		spill.In() <- elem
+	}
+}
+
+// closeAndWait closes the channel and waits for it to drain, or for the context to finish first.
+func closeAndWait(ctx context.Context, ch SimpleInChannel, done <-chan struct{}) error {
+	ch.Close()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
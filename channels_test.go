@@ -1,7 +1,10 @@
 package channels
 
 import (
+	"context"
+	"errors"
 	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -50,6 +53,245 @@ func testChannelConcurrentAccessors(t *testing.T, name string, ch Channel) {
 	}()
 }
 
+func testChannelClose(t *testing.T, name string, ch SimpleInChannel) {
+	ch.Close()
+	ch.Close()
+
+	ec, ok := ch.(ErrorCloser)
+	if !ok {
+		return
+	}
+	if ec.Err() != nil {
+		t.Error(name, "had error", ec.Err(), "after Close")
+	}
+	ec.CloseWithError(errors.New("too late"))
+	if ec.Err() != nil {
+		t.Error(name, "recorded error from second close")
+	}
+}
+
+func testChannelCloseWithError(t *testing.T, name string, ch Channel) {
+	reason := errors.New("reason")
+	ec := ch.(ErrorCloser)
+	if ec.Err() != nil {
+		t.Error(name, "had error", ec.Err(), "while open")
+	}
+	ec.CloseWithError(reason)
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+	if ec.Err() != reason {
+		t.Error(name, "expected error", reason, "but got", ec.Err())
+	}
+}
+
+// waitForLen polls until the buffer reaches the expected length, since for most implementations Len() is
+// updated just after each read or write completes rather than atomically with it.
+func waitForLen(t *testing.T, name string, buf Buffer, expected int) {
+	for deadline := time.Now().Add(time.Second); buf.Len() != expected; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(name, "expected length", expected, "but got", buf.Len())
+		}
+	}
+}
+
+// testChannelLen checks the Len() semantics shared by every implementation: values are counted from when they
+// are written to In() until they are read from Out(), including any value waiting to be read.
+func testChannelLen(t *testing.T, name string, ch Channel) {
+	waitForLen(t, name, ch, 0)
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, name, ch, 3)
+
+	for received := 0; received < 3; {
+		val := <-ch.Out()
+		if batch, ok := val.([]interface{}); ok {
+			received += len(batch)
+		} else {
+			received++
+		}
+		waitForLen(t, name, ch, 3-received)
+	}
+}
+
+func TestLen(t *testing.T) {
+	testChannelLen(t, "native channel", NewNativeChannel(5))
+	testChannelLen(t, "infinite channel", NewInfiniteChannel())
+	testChannelLen(t, "ring channel", NewRingChannel(5))
+	testChannelLen(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelLen(t, "batching channel", NewBatchingChannel(5))
+	testChannelLen(t, "locked infinite channel", NewLockedInfiniteChannel())
+	testChannelLen(t, "locked batching channel", NewLockedBatchingChannel(5))
+
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	testChannelLen(t, "resizable channel", ch)
+}
+
+func testChannelWatermarks(t *testing.T, name string, ch Channel) {
+	events := make(chan string, 10)
+	ch.(Watermarker).SetWatermarks(&Watermarks{
+		High:   3,
+		Low:    1,
+		OnHigh: func(length int) { events <- "high " + strconv.Itoa(length) },
+		OnLow:  func(length int) { events <- "low" },
+	})
+
+	for i := 0; i < 4; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, name, ch, 4)
+	if event := <-events; event != "high 3" {
+		t.Error(name, "expected high watermark but got", event)
+	}
+
+	for received := 0; received < 4; {
+		val := <-ch.Out()
+		if batch, ok := val.([]interface{}); ok {
+			received += len(batch)
+		} else {
+			received++
+		}
+	}
+	waitForLen(t, name, ch, 0)
+	if event := <-events; event != "low" {
+		t.Error(name, "expected low watermark but got", event)
+	}
+	select {
+	case event := <-events:
+		t.Error(name, "got unexpected watermark", event)
+	default:
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	testChannelWatermarks(t, "infinite channel", NewInfiniteChannel())
+	testChannelWatermarks(t, "ring channel", NewRingChannel(5))
+	testChannelWatermarks(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelWatermarks(t, "batching channel", NewBatchingChannel(5))
+	testChannelWatermarks(t, "locked infinite channel", NewLockedInfiniteChannel())
+
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	testChannelWatermarks(t, "resizable channel", ch)
+}
+
+func testChannelDrain(t *testing.T, name string, ch Channel) {
+	drainer := ch.(Drainer)
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := drainer.CloseAndWait(ctx); err != context.DeadlineExceeded {
+		t.Error(name, "drained without a reader, got", err)
+	}
+	select {
+	case <-drainer.Done():
+		t.Error(name, "was done before draining")
+	default:
+	}
+
+	for _ = range ch.Out() {
+	}
+	<-drainer.Done()
+	if err := drainer.CloseAndWait(context.Background()); err != nil {
+		t.Error(name, "failed to wait on drained channel", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	testChannelDrain(t, "infinite channel", NewInfiniteChannel())
+	testChannelDrain(t, "ring channel", NewRingChannel(5))
+	testChannelDrain(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelDrain(t, "batching channel", NewBatchingChannel(5))
+
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	testChannelDrain(t, "resizable channel", ch)
+}
+
+func testChannelSnapshot(t *testing.T, name string, ch Channel) {
+	snap := ch.(Snapshotter)
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+	for ch.Len() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, contents := range [][]interface{}{snap.Snapshot(), snap.Drain()} {
+		if len(contents) != 3 {
+			t.Fatal(name, "expected 3 buffered values but got", contents)
+		}
+		for i := range contents {
+			if contents[i].(int) != i {
+				t.Error(name, "expected", i, "but got", contents[i])
+			}
+		}
+	}
+
+	if ch.Len() != 0 {
+		t.Error(name, "still had", ch.Len(), "values after draining")
+	}
+	if contents := snap.Snapshot(); len(contents) != 0 {
+		t.Error(name, "had contents", contents, "after draining")
+	}
+
+	ch.Close()
+	<-ch.(Drainer).Done()
+	if contents := snap.Drain(); contents != nil {
+		t.Error(name, "had contents", contents, "after finishing")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	testChannelSnapshot(t, "infinite channel", NewInfiniteChannel())
+	testChannelSnapshot(t, "ring channel", NewRingChannel(5))
+	testChannelSnapshot(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelSnapshot(t, "batching channel", NewBatchingChannel(5))
+
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	testChannelSnapshot(t, "resizable channel", ch)
+
+	if contents := NewRingChannel(None).Snapshot(); contents != nil {
+		t.Error("unbuffered ring channel had contents", contents)
+	}
+	if contents := NewOverflowingChannel(None).Drain(); contents != nil {
+		t.Error("unbuffered overflowing channel had contents", contents)
+	}
+}
+
+func TestClose(t *testing.T) {
+	testChannelClose(t, "native channel", NewNativeChannel(None))
+	testChannelClose(t, "native in channel", NativeInChannel(make(chan interface{})))
+	testChannelClose(t, "dead channel", NewDeadChannel())
+	testChannelClose(t, "black hole", NewBlackHole())
+	testChannelClose(t, "infinite channel", NewInfiniteChannel())
+	testChannelClose(t, "resizable channel", NewResizableChannel())
+	testChannelClose(t, "ring channel", NewRingChannel(5))
+	testChannelClose(t, "unbuffered ring channel", NewRingChannel(None))
+	testChannelClose(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelClose(t, "unbuffered overflowing channel", NewOverflowingChannel(None))
+	testChannelClose(t, "batching channel", NewBatchingChannel(5))
+	testChannelClose(t, "stack channel", NewStackChannel(5, Block))
+
+	buf := NewSharedBuffer(5)
+	testChannelClose(t, "shared buffer channel", buf.NewChannel())
+	buf.Close()
+	buf.Close()
+
+	testChannelCloseWithError(t, "infinite channel", NewInfiniteChannel())
+	testChannelCloseWithError(t, "resizable channel", NewResizableChannel())
+	testChannelCloseWithError(t, "ring channel", NewRingChannel(5))
+	testChannelCloseWithError(t, "overflowing channel", NewOverflowingChannel(5))
+	testChannelCloseWithError(t, "batching channel", NewBatchingChannel(5))
+	testChannelCloseWithError(t, "stack channel", NewStackChannel(5, Block))
+}
+
 func TestPipe(t *testing.T) {
 	a := NewNativeChannel(None)
 	b := NewNativeChannel(None)
@@ -111,6 +353,84 @@ func TestWeakMultiplex(t *testing.T) {
 	testMultiplex(t, WeakMultiplex)
 }
 
+func TestMultiplexWide(t *testing.T) {
+	a := NewNativeChannel(None)
+	inputs := make([]SimpleOutChannel, maxNativeFan+2)
+	for i := range inputs {
+		inputs[i] = NewNativeChannel(None)
+	}
+
+	Multiplex(a, inputs...)
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			inputs[i%len(inputs)].(Channel).In() <- i
+		}
+		for i := range inputs {
+			inputs[i].(Channel).Close()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		val := <-a.Out()
+		if i != val.(int) {
+			t.Fatal("wide multiplexing expected", i, "but got", val.(int))
+		}
+	}
+	if _, open := <-a.Out(); open {
+		t.Error("wide multiplexing didn't close output")
+	}
+}
+
+func testMergeSorted(t *testing.T, merge func(output SimpleInChannel, less func(a, b interface{}) bool, inputs ...SimpleOutChannel)) {
+	less := func(a, b interface{}) bool { return a.(int) < b.(int) }
+
+	a := NewNativeChannel(None)
+	b := NewNativeChannel(None)
+
+	merge(b, less, a)
+
+	testChannelPair(t, "simple merge", a, b)
+
+	a = NewNativeChannel(None)
+	inputs := []Channel{
+		NewNativeChannel(None),
+		NewNativeChannel(None),
+		NewNativeChannel(None),
+		NewNativeChannel(None),
+	}
+	// one input is closed before we even start
+	inputs[3].Close()
+
+	merge(a, less, inputs[0], inputs[1], inputs[2], inputs[3])
+
+	for i := 0; i < 3; i++ {
+		go func(ch Channel, offset int) {
+			for j := offset; j < 1000; j += 3 {
+				if offset == 0 {
+					// a slow input must not let anything out of order
+					time.Sleep(time.Microsecond)
+				}
+				ch.In() <- j
+			}
+			ch.Close()
+		}(inputs[i], i)
+	}
+	for i := 0; i < 1000; i++ {
+		val := <-a.Out()
+		if i != val.(int) {
+			t.Fatal("merging expected", i, "but got", val.(int))
+		}
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	testMergeSorted(t, MergeSorted)
+}
+
+func TestWeakMergeSorted(t *testing.T) {
+	testMergeSorted(t, WeakMergeSorted)
+}
+
 func testTee(t *testing.T, tee func(input SimpleOutChannel, outputs ...SimpleInChannel)) {
 	a := NewNativeChannel(None)
 	b := NewNativeChannel(None)
@@ -153,6 +473,31 @@ func TestWeakTee(t *testing.T) {
 	testTee(t, WeakTee)
 }
 
+func TestTeeWide(t *testing.T) {
+	a := NewNativeChannel(None)
+	outputs := make([]SimpleInChannel, maxNativeFan+2)
+	for i := range outputs {
+		outputs[i] = NewNativeChannel(None)
+	}
+
+	Tee(a, outputs...)
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			a.In() <- i
+		}
+		a.Close()
+	}()
+	for i := 0; i < 1000; i++ {
+		for _, output := range outputs {
+			val := <-output.(Channel).Out()
+			if i != val.(int) {
+				t.Fatal("wide teeing expected", i, "but got", val.(int))
+			}
+		}
+	}
+}
+
 func testDistribute(t *testing.T, dist func(input SimpleOutChannel, outputs ...SimpleInChannel)) {
 	a := NewNativeChannel(None)
 	b := NewNativeChannel(None)
@@ -207,6 +552,100 @@ func TestWeakDistribute(t *testing.T) {
 	testDistribute(t, WeakDistribute)
 }
 
+func TestDistributeWide(t *testing.T) {
+	a := NewNativeChannel(None)
+	b := NewNativeChannel(None)
+	outputs := make([]SimpleInChannel, maxNativeFan+2)
+	for i := range outputs {
+		outputs[i] = NewNativeChannel(None)
+	}
+
+	Distribute(a, outputs...)
+	for i := range outputs {
+		WeakPipe(outputs[i].(Channel), b)
+	}
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			a.In() <- i
+		}
+		a.Close()
+	}()
+
+	received := make([]bool, 1000)
+	for _ = range received {
+		val := <-b.Out()
+		if received[val.(int)] {
+			t.Fatal("wide distribute got value twice", val.(int))
+		}
+		received[val.(int)] = true
+	}
+}
+
+func benchmarkFanIn(b *testing.B, multi func(output SimpleInChannel, inputs []SimpleOutChannel)) {
+	output := NewNativeChannel(None)
+	inputs := make([]SimpleOutChannel, maxNativeFan)
+	for i := range inputs {
+		inputs[i] = NewNativeChannel(None)
+	}
+	go multi(output, inputs)
+
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			inputs[i%len(inputs)].(Channel).In() <- nil
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-output.Out()
+	}
+}
+
+func benchmarkFanOut(b *testing.B, values int, fan func(input SimpleOutChannel, outputs []SimpleInChannel)) {
+	input := NewNativeChannel(None)
+	output := NewNativeChannel(None)
+	outputs := make([]SimpleInChannel, maxNativeFan)
+	for i := range outputs {
+		outputs[i] = NewNativeChannel(None)
+		WeakPipe(outputs[i].(Channel), output)
+	}
+	go fan(input, outputs)
+
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			input.In() <- nil
+		}
+	}()
+	for i := 0; i < b.N*values; i++ {
+		<-output.Out()
+	}
+}
+
+func BenchmarkMultiplexNative(b *testing.B) {
+	benchmarkFanIn(b, multiplexNative)
+}
+
+func BenchmarkMultiplexReflect(b *testing.B) {
+	benchmarkFanIn(b, multiplexReflect)
+}
+
+func BenchmarkTeeNative(b *testing.B) {
+	benchmarkFanOut(b, maxNativeFan, teeNative)
+}
+
+func BenchmarkTeeReflect(b *testing.B) {
+	benchmarkFanOut(b, maxNativeFan, teeReflect)
+}
+
+func BenchmarkDistributeNative(b *testing.B) {
+	benchmarkFanOut(b, 1, distributeNative)
+}
+
+func BenchmarkDistributeReflect(b *testing.B) {
+	benchmarkFanOut(b, 1, distributeReflect)
+}
+
 func TestWrap(t *testing.T) {
 	rawChan := make(chan int, 5)
 	ch := Wrap(rawChan)
@@ -250,6 +689,70 @@ func TestUnwrap(t *testing.T) {
 	}
 }
 
+func TestUnwrapConvert(t *testing.T) {
+	rawChan := make(chan int)
+	deadLetter := NewNativeChannel(5)
+	ch := NewNativeChannel(5)
+	convert := func(x interface{}) (interface{}, error) {
+		if s, ok := x.(string); ok {
+			return strconv.Atoi(s)
+		}
+		return x, nil
+	}
+	UnwrapConvert(ch, rawChan, convert, deadLetter)
+
+	ch.In() <- 0
+	ch.In() <- "1"
+	ch.In() <- "two"
+	ch.In() <- 3.0
+	ch.In() <- 2
+	ch.Close()
+
+	for i := 0; i < 3; i++ {
+		x := <-rawChan
+		if x != i {
+			t.Error("Unwrapped value", x, "was expecting", i)
+		}
+	}
+	_, ok := <-rawChan
+	if ok {
+		t.Error("Unwrapped channel didn't close")
+	}
+
+	if deadLetter.Len() != 2 {
+		t.Fatal("expected 2 dead letters but got", deadLetter.Len())
+	}
+	if x := <-deadLetter.Out(); x != "two" {
+		t.Error("unexpected dead letter", x)
+	}
+	if x := <-deadLetter.Out(); x != 3.0 {
+		t.Error("unexpected dead letter", x)
+	}
+}
+
+func TestWrapIn(t *testing.T) {
+	rawChan := make(chan int)
+	ch := WrapIn(rawChan)
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			ch.In() <- i
+		}
+		ch.Close()
+	}()
+
+	for i := 0; i < 5; i++ {
+		x := <-rawChan
+		if x != i {
+			t.Error("Wrapped value", x, "was expecting", i)
+		}
+	}
+	_, ok := <-rawChan
+	if ok {
+		t.Error("Wrapped channel didn't close")
+	}
+}
+
 func ExampleChannel() {
 	var ch Channel
 
@@ -0,0 +1,45 @@
+package channels
+
+import "sync"
+
+// closeState makes closing a channel idempotent and records the error (if any) it was closed with.
+// It is embedded by value in each of the goroutine-backed channel types.
+type closeState struct {
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+func (cs *closeState) close(ch chan interface{}, err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		return
+	}
+	cs.closed = true
+	cs.err = err
+	close(ch)
+}
+
+func (cs *closeState) isClosed() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.closed
+}
+
+func (cs *closeState) error() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.err
+}
+
+// closeNative closes a native channel, ignoring the panic if it has already been closed. Closing a nil
+// channel still panics as usual.
+func closeNative(ch chan<- interface{}) {
+	defer func() {
+		if ch != nil {
+			recover()
+		}
+	}()
+	close(ch)
+}
@@ -0,0 +1,115 @@
+package channels
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// CoDelChannel implements the Channel interface with a buffer managed by the controlled delay (CoDel) active
+// queue management algorithm of RFC 8289. Rather than waiting for the buffer to fill before discarding anything,
+// as RingChannel and OverflowingChannel do, it watches how long each value has spent in the buffer by the time it
+// reaches the head. Once that has exceeded the target delay for a whole interval, values are discarded from the
+// head at an increasing rate until the delay falls back below the target. Under sustained overload this keeps the
+// queueing delay close to the target, while still letting short bursts through untouched.
+//
+// Like the RFC, CoDelChannel makes its decisions as values reach the head of the buffer and while they wait
+// there; the capacity is only a backstop, beyond which newly written values are discarded as by an
+// OverflowingChannel. It is a PolicyChannel with a QueueStorage and the DropNewest policy.
+type CoDelChannel struct {
+	policyBuffer
+}
+
+// CoDelStats reports what a CoDelChannel has discarded.
+type CoDelStats struct {
+	Dropped    uint64 // values discarded by CoDel for having waited too long
+	Overflowed uint64 // values discarded because the buffer was full
+	Dropping   bool   // whether CoDel is currently discarding values
+}
+
+// NewCoDelChannel creates a CoDelChannel with the given capacity, target delay and interval. A zero target or
+// interval means the defaults recommended by the RFC, 5ms and 100ms; the interval should be around the time
+// a reader takes to respond to the channel filling up. It panics if either is negative.
+func NewCoDelChannel(size BufferCap, target, interval time.Duration) *CoDelChannel {
+	checkSize(size, "NewCoDelChannel")
+	if target < 0 || interval < 0 {
+		panic("channels: invalid negative delay in NewCoDelChannel")
+	}
+	if target == 0 {
+		target = 5 * time.Millisecond
+	}
+	if interval == 0 {
+		interval = 100 * time.Millisecond
+	}
+	ch := &CoDelChannel{}
+	ch.codel = &codel{target: target, interval: interval}
+	ch.start(size, NewQueueStorage(), DropNewest, nil)
+	return ch
+}
+
+func (ch *CoDelChannel) DropStats() CoDelStats {
+	return CoDelStats{
+		Dropped:    atomic.LoadUint64(&ch.codel.dropped),
+		Overflowed: atomic.LoadUint64(&ch.droppedCount),
+		Dropping:   atomic.LoadInt32(&ch.codel.dropping) != 0,
+	}
+}
+
+// codel holds the state of the CoDel algorithm for a channel's goroutine; only the counters are read elsewhere.
+type codel struct {
+	dropped  uint64
+	dropping int32
+
+	target, interval     time.Duration
+	firstAbove, dropNext time.Time
+	count, lastCount     int
+}
+
+// check decides whether the value at the head of the buffer, written at the given time, should be dropped.
+// If not, it returns the time at which the decision might change.
+func (c *codel) check(now, written time.Time, length int) (drop bool, wake time.Time) {
+	okToDrop := false
+	if now.Sub(written) < c.target || length <= 1 {
+		c.firstAbove = time.Time{}
+	} else if c.firstAbove.IsZero() {
+		c.firstAbove = now.Add(c.interval)
+	} else if !now.Before(c.firstAbove) {
+		okToDrop = true
+	}
+
+	if c.dropping != 0 {
+		if !okToDrop {
+			atomic.StoreInt32(&c.dropping, 0)
+		} else if !now.Before(c.dropNext) {
+			c.count++
+			c.dropNext = c.controlLaw(c.dropNext)
+			return true, time.Time{}
+		}
+	} else if okToDrop {
+		atomic.StoreInt32(&c.dropping, 1)
+		// if we were dropping recently, carry on at close to the same rate rather than starting again
+		delta := c.count - c.lastCount
+		if delta > 1 && now.Sub(c.dropNext) < 16*c.interval {
+			c.count = delta
+		} else {
+			c.count = 1
+		}
+		c.dropNext = c.controlLaw(now)
+		c.lastCount = c.count
+		return true, time.Time{}
+	}
+
+	switch {
+	case c.dropping != 0:
+		return false, c.dropNext
+	case !c.firstAbove.IsZero():
+		return false, c.firstAbove
+	case length > 1:
+		return false, written.Add(c.target)
+	}
+	return false, time.Time{}
+}
+
+func (c *codel) controlLaw(t time.Time) time.Time {
+	return t.Add(time.Duration(float64(c.interval) / math.Sqrt(float64(c.count))))
+}
@@ -0,0 +1,68 @@
+package channels
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoDelChannel(t *testing.T) {
+	var ch Channel
+
+	ch = NewCoDelChannel(Infinity, 0, 0)
+	testChannel(t, "codel channel", ch)
+
+	ch = NewCoDelChannel(Infinity, 0, 0)
+	testChannelPair(t, "codel channel", ch, ch)
+
+	ch = NewCoDelChannel(5, 0, 0)
+	testChannelConcurrentAccessors(t, "codel channel", ch)
+
+	testChannelClose(t, "codel channel", NewCoDelChannel(5, 0, 0))
+	testChannelCloseWithError(t, "codel channel", NewCoDelChannel(5, 0, 0))
+}
+
+func TestCoDelChannelDrops(t *testing.T) {
+	ch := NewCoDelChannel(Infinity, time.Millisecond, 10*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		ch.In() <- i
+	}
+
+	// nobody is reading, so the queueing delay soon exceeds the target and CoDel starts dropping
+	time.Sleep(100 * time.Millisecond)
+	stats := ch.DropStats()
+	if stats.Dropped == 0 || !stats.Dropping {
+		t.Error("codel channel did not drop anything", stats)
+	}
+	if stats.Overflowed != 0 {
+		t.Error("codel channel overflowed", stats)
+	}
+	if ch.Len()+int(stats.Dropped) > 100 {
+		t.Error("codel channel has length", ch.Len(), "after dropping", stats.Dropped)
+	}
+
+	ch.Close()
+	prev := -1
+	for val := range ch.Out() {
+		if val.(int) <= prev {
+			t.Fatal("codel channel delivered", val, "after", prev)
+		}
+		prev = val.(int)
+	}
+	if prev != 99 {
+		t.Error("codel channel did not deliver the last value")
+	}
+}
+
+func TestCoDelChannelOverflow(t *testing.T) {
+	ch := NewCoDelChannel(5, time.Hour, time.Hour)
+	for i := 0; i < 10; i++ {
+		ch.In() <- i
+	}
+	if contents := ch.Snapshot(); len(contents) != 5 {
+		t.Error("codel channel contained", contents)
+	}
+	if stats := ch.DropStats(); stats.Overflowed != 5 || stats.Dropped != 0 || stats.Dropping {
+		t.Error("codel channel reported", stats)
+	}
+	ch.Close()
+}
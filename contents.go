@@ -0,0 +1,36 @@
+package channels
+
+import "github.com/eapache/queue"
+
+// contentsRequest asks a channel's goroutine for a copy of its buffered values, optionally removing them.
+type contentsRequest struct {
+	drain bool
+	reply chan []interface{}
+}
+
+// requestContents sends a contentsRequest to a channel's goroutine, over the channel it takes its other requests
+// from, and waits for the reply. A nil requests channel or a channel which has already finished draining has no
+// contents.
+func requestContents(requests chan<- interface{}, done <-chan struct{}, drain bool) []interface{} {
+	if requests == nil {
+		return nil
+	}
+	req := contentsRequest{drain: drain, reply: make(chan []interface{}, 1)}
+	select {
+	case requests <- req:
+		return <-req.reply
+	case <-done:
+		return nil
+	}
+}
+
+func queueContents(q *queue.Queue) []interface{} {
+	if q.Length() == 0 {
+		return nil
+	}
+	contents := make([]interface{}, q.Length())
+	for i := range contents {
+		contents[i] = q.Get(i)
+	}
+	return contents
+}
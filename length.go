@@ -0,0 +1,66 @@
+package channels
+
+import "sync/atomic"
+
+// Watermarks configures callbacks which fire as the length of a channel's buffer crosses two thresholds, with
+// hysteresis: OnHigh is called when the length rises to High or above, after which OnLow is called when it falls
+// back to Low or below, after which OnHigh can fire again, and so on. Either callback may be nil.
+//
+// The callbacks are called from whichever goroutine changed the length (usually the channel's own goroutine),
+// so they must return quickly and must not call any of the channel's methods other than Len and Cap.
+type Watermarks struct {
+	High, Low int
+	OnHigh    func(length int)
+	OnLow     func(length int)
+}
+
+type watermarkState struct {
+	Watermarks
+	high bool
+}
+
+func (w *watermarkState) update(n int) {
+	if !w.high && n >= w.High {
+		w.high = true
+		if w.OnHigh != nil {
+			w.OnHigh(n)
+		}
+	} else if w.high && n <= w.Low {
+		w.high = false
+		if w.OnLow != nil {
+			w.OnLow(n)
+		}
+	}
+}
+
+// lengthGauge holds the length of a channel's buffer so that Len() can be answered immediately, without
+// waiting for the goroutine which manages the buffer to get around to it. It must be the first field of
+// any struct containing it so that the 64-bit value is correctly aligned on 32-bit platforms.
+// Only one goroutine at a time may call set.
+type lengthGauge struct {
+	value int64
+	marks atomic.Value // *watermarkState
+}
+
+func (g *lengthGauge) set(n int) {
+	atomic.StoreInt64(&g.value, int64(n))
+	if marks, _ := g.marks.Load().(*watermarkState); marks != nil {
+		marks.update(n)
+	}
+}
+
+func (g *lengthGauge) get() int {
+	return int(atomic.LoadInt64(&g.value))
+}
+
+// watch replaces the gauge's watermarks; nil removes them. It panics if they are invalid.
+func (g *lengthGauge) watch(marks *Watermarks) {
+	if marks == nil {
+		g.marks.Store((*watermarkState)(nil))
+		return
+	}
+	if marks.Low < 0 || marks.Low >= marks.High {
+		panic("channels: invalid watermarks, Low must be at least 0 and less than High")
+	}
+	g.marks.Store(&watermarkState{Watermarks: *marks})
+}
@@ -0,0 +1,372 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eapache/queue"
+)
+
+type lockedOverflow int
+
+const (
+	lockedBlock lockedOverflow = iota
+	lockedDropOldest
+	lockedDropNewest
+)
+
+// LockedChannel implements the Channel interface with a buffer protected by a mutex, rather than by a
+// dedicated goroutine like the other buffered types in this package. Values are normally written with Send
+// and read with Recv or RecvBatch; the In() and Out() channels are only created (each with a goroutine to pump
+// values between it and the buffer) the first time they are asked for. A LockedChannel which is never asked
+// for In() or Out() therefore has no goroutines to leak if it passes out of scope, and Len() is answered from
+// an atomic counter without waiting on anything.
+//
+// The behaviour when the buffer is full depends on the constructor used: the equivalents of InfiniteChannel
+// and ResizableChannel block the writer, that of RingChannel discards the oldest value and that of
+// OverflowingChannel discards the newest. Unbuffered (None) LockedChannels are not supported.
+//
+// A value (or batch) taken from the buffer by the Out() pump is still counted by Len() until it is delivered.
+// For the blocking kinds it also still counts against the capacity, so Len() never exceeds Cap(); the ring and
+// overflowing kinds can't take back a value the pump is waiting to deliver, so for them Len() may exceed Cap() by
+// the one value in transit.
+type LockedChannel struct {
+	length, capacity  lengthGauge // capacity mirrors size, so that Cap doesn't need the lock
+	metrics           metricsHook
+	mu                sync.Mutex
+	notEmpty, notFull *sync.Cond
+	buffer            *queue.Queue
+	size              BufferCap
+	overflow          lockedOverflow
+	batching          bool
+	inFlight          int // values taken by the Out() pump but not yet delivered
+	closing, closed   bool
+	drained           bool
+	err               error
+	done              chan struct{}
+
+	inputOnce, outputOnce sync.Once
+	input, output         chan interface{}
+}
+
+func newLockedChannel(size BufferCap, overflow lockedOverflow, batching bool) *LockedChannel {
+	ch := &LockedChannel{
+		buffer:   queue.New(),
+		size:     size,
+		overflow: overflow,
+		batching: batching,
+		done:     make(chan struct{}),
+	}
+	ch.capacity.set(int(size))
+	ch.notEmpty = sync.NewCond(&ch.mu)
+	ch.notFull = sync.NewCond(&ch.mu)
+	return ch
+}
+
+func checkLockedSize(size BufferCap, constructor string) {
+	if size == None {
+		panic("channels: LockedChannel does not support unbuffered behaviour")
+	}
+	if size < 0 && size != Infinity {
+		panic("channels: invalid negative size in " + constructor)
+	}
+}
+
+// NewLockedInfiniteChannel creates a LockedChannel with an infinite buffer, like InfiniteChannel.
+func NewLockedInfiniteChannel() *LockedChannel {
+	return newLockedChannel(Infinity, lockedBlock, false)
+}
+
+// NewLockedResizableChannel creates a LockedChannel with a buffer of size 1 which blocks writers when full
+// and can be resized with Resize, like ResizableChannel.
+func NewLockedResizableChannel() *LockedChannel {
+	return newLockedChannel(1, lockedBlock, false)
+}
+
+// NewLockedRingChannel creates a LockedChannel which discards the oldest buffered value when a value is
+// written to a full buffer, like RingChannel.
+func NewLockedRingChannel(size BufferCap) *LockedChannel {
+	checkLockedSize(size, "NewLockedRingChannel")
+	return newLockedChannel(size, lockedDropOldest, false)
+}
+
+// NewLockedOverflowingChannel creates a LockedChannel which discards values written to a full buffer,
+// like OverflowingChannel.
+func NewLockedOverflowingChannel(size BufferCap) *LockedChannel {
+	checkLockedSize(size, "NewLockedOverflowingChannel")
+	return newLockedChannel(size, lockedDropNewest, false)
+}
+
+// NewLockedBatchingChannel creates a LockedChannel which blocks writers when full and whose Out() produces
+// the entire buffer each time as a []interface{}, like BatchingChannel. Recv still returns individual
+// values; use RecvBatch to take the whole buffer without going through Out().
+func NewLockedBatchingChannel(size BufferCap) *LockedChannel {
+	checkLockedSize(size, "NewLockedBatchingChannel")
+	return newLockedChannel(size, lockedBlock, true)
+}
+
+// In returns a writeable channel which feeds the buffer, starting the goroutine which does so on the first call.
+func (ch *LockedChannel) In() chan<- interface{} {
+	ch.inputOnce.Do(func() {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		ch.input = make(chan interface{})
+		if ch.closing {
+			close(ch.input)
+			return
+		}
+		go ch.pumpInput()
+	})
+	return ch.input
+}
+
+// Out returns a readable channel fed from the buffer, starting the goroutine which does so on the first call.
+func (ch *LockedChannel) Out() <-chan interface{} {
+	ch.outputOnce.Do(func() {
+		ch.output = make(chan interface{})
+		go ch.pumpOutput()
+	})
+	return ch.output
+}
+
+func (ch *LockedChannel) Len() int {
+	return ch.length.get()
+}
+
+func (ch *LockedChannel) Cap() BufferCap {
+	return BufferCap(ch.capacity.get())
+}
+
+// Resize changes the capacity of the buffer. As with ResizableChannel, shrinking it below its current length
+// does not discard anything; writers simply block until enough values have been read. Only the kinds which block
+// writers can be resized: it panics for those created by NewLockedRingChannel or NewLockedOverflowingChannel,
+// which would have to discard values to honour a smaller capacity.
+func (ch *LockedChannel) Resize(newSize BufferCap) {
+	if ch.overflow != lockedBlock {
+		panic("channels: Resize is not supported by ring or overflowing LockedChannels")
+	}
+	checkLockedSize(newSize, "Resize")
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.size = newSize
+	ch.capacity.set(int(newSize))
+	ch.notFull.Broadcast()
+}
+
+func (ch *LockedChannel) Close() {
+	ch.CloseWithError(nil)
+}
+
+func (ch *LockedChannel) CloseWithError(err error) {
+	ch.mu.Lock()
+	if ch.closing {
+		ch.mu.Unlock()
+		return
+	}
+	ch.closing = true
+	ch.err = err
+	input := ch.input
+	ch.mu.Unlock()
+
+	if input != nil {
+		// the pump finishes closing once it has passed on everything written to In()
+		close(input)
+	} else {
+		ch.finishClose()
+	}
+}
+
+func (ch *LockedChannel) Err() error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.err
+}
+
+func (ch *LockedChannel) Done() <-chan struct{} {
+	return ch.done
+}
+
+func (ch *LockedChannel) CloseAndWait(ctx context.Context) error {
+	return closeAndWait(ctx, ch, ch.done)
+}
+
+func (ch *LockedChannel) Snapshot() []interface{} {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return queueContents(ch.buffer)
+}
+
+func (ch *LockedChannel) Drain() []interface{} {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	contents := queueContents(ch.buffer)
+	ch.buffer = queue.New()
+	ch.metrics.dequeued(len(contents))
+	ch.updated()
+	ch.notFull.Broadcast()
+	return contents
+}
+
+func (ch *LockedChannel) SetWatermarks(marks *Watermarks) {
+	ch.length.watch(marks)
+}
+
+func (ch *LockedChannel) SetMetrics(m Metrics) {
+	ch.metrics.set(m)
+}
+
+func (ch *LockedChannel) inspect() inspection {
+	ch.mu.Lock()
+	closed := ch.closing
+	ch.mu.Unlock()
+	read, dropped := ch.metrics.totals()
+	return inspection{closed: closed, read: read, dropped: dropped}
+}
+
+// Send writes a value to the buffer, blocking while it is full if the channel is of a blocking kind.
+// It returns ErrClosed (or the error passed to CloseWithError) if the channel has been closed.
+func (ch *LockedChannel) Send(val interface{}) error {
+	return ch.add(val, false)
+}
+
+// Recv reads the next value from the buffer, blocking until one is available. The boolean is false if the
+// channel has been closed and drained.
+func (ch *LockedChannel) Recv() (interface{}, bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if !ch.waitNotEmpty() {
+		return nil, false
+	}
+	val := ch.buffer.Remove()
+	ch.metrics.dequeued(1)
+	ch.updated()
+	ch.notFull.Signal()
+	return val, true
+}
+
+// RecvBatch reads every value currently in the buffer, blocking until there is at least one. The boolean is
+// false if the channel has been closed and drained.
+func (ch *LockedChannel) RecvBatch() ([]interface{}, bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if !ch.waitNotEmpty() {
+		return nil, false
+	}
+	batch := queueContents(ch.buffer)
+	ch.buffer = queue.New()
+	ch.metrics.dequeued(len(batch))
+	ch.updated()
+	ch.notFull.Broadcast()
+	return batch, true
+}
+
+func (ch *LockedChannel) add(val interface{}, fromInput bool) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.overflow == lockedBlock && ch.full() && !ch.closed {
+		start := time.Now()
+		for ch.full() && !ch.closed {
+			ch.notFull.Wait()
+		}
+		ch.metrics.blocked(time.Now().Sub(start))
+	}
+	// writes already made to In() are still accepted while the input pump catches up after Close
+	if ch.closed || (ch.closing && !fromInput) {
+		if ch.err != nil {
+			return ch.err
+		}
+		return ErrClosed
+	}
+	if ch.full() {
+		ch.metrics.dropped(1)
+		if ch.overflow == lockedDropNewest {
+			return nil
+		}
+		ch.buffer.Remove()
+	}
+	ch.buffer.Add(val)
+	ch.metrics.enqueued(1)
+	ch.updated()
+	ch.notEmpty.Signal()
+	return nil
+}
+
+// must be called with the lock held; returns false if the channel is closed and empty
+func (ch *LockedChannel) waitNotEmpty() bool {
+	for ch.buffer.Length() == 0 && !ch.closed {
+		ch.notEmpty.Wait()
+	}
+	return ch.buffer.Length() > 0
+}
+
+// must be called with the lock held
+func (ch *LockedChannel) full() bool {
+	if ch.size == Infinity {
+		return false
+	}
+	length := ch.buffer.Length()
+	if ch.overflow == lockedBlock {
+		length += ch.inFlight
+	}
+	return length >= int(ch.size)
+}
+
+// must be called with the lock held after any change to the buffer
+func (ch *LockedChannel) updated() {
+	ch.metrics.setLength(&ch.length, ch.buffer.Length()+ch.inFlight)
+	if ch.closed && !ch.drained && ch.buffer.Length() == 0 && ch.inFlight == 0 {
+		ch.drained = true
+		close(ch.done)
+	}
+}
+
+func (ch *LockedChannel) finishClose() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.closed = true
+	ch.updated()
+	ch.notEmpty.Broadcast()
+	ch.notFull.Broadcast()
+}
+
+func (ch *LockedChannel) pumpInput() {
+	for val := range ch.input {
+		ch.add(val, true)
+	}
+	ch.finishClose()
+}
+
+func (ch *LockedChannel) pumpOutput() {
+	for {
+		// values stay counted by Len() until they have actually been delivered
+		ch.mu.Lock()
+		if !ch.waitNotEmpty() {
+			ch.mu.Unlock()
+			close(ch.output)
+			return
+		}
+		var val interface{}
+		if ch.batching {
+			batch := queueContents(ch.buffer)
+			ch.buffer = queue.New()
+			ch.inFlight = len(batch)
+			val = batch
+			ch.notFull.Broadcast()
+		} else {
+			val = ch.buffer.Remove()
+			ch.inFlight = 1
+			ch.notFull.Signal()
+		}
+		ch.mu.Unlock()
+
+		ch.output <- val
+
+		ch.mu.Lock()
+		ch.metrics.dequeued(ch.inFlight)
+		ch.inFlight = 0
+		ch.updated()
+		ch.notFull.Broadcast()
+		ch.mu.Unlock()
+	}
+}
@@ -0,0 +1,193 @@
+package channels
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockedChannel(t *testing.T) {
+	var ch Channel
+
+	ch = NewLockedInfiniteChannel()
+	testChannel(t, "locked infinite channel", ch)
+
+	ch = NewLockedInfiniteChannel()
+	testChannelPair(t, "locked infinite channel", ch, ch)
+
+	ch = NewLockedInfiniteChannel()
+	testChannelConcurrentAccessors(t, "locked infinite channel", ch)
+
+	ch = NewLockedResizableChannel()
+	testChannel(t, "locked resizable channel", ch)
+
+	ch = NewLockedResizableChannel()
+	testChannelPair(t, "locked resizable channel", ch, ch)
+
+	ch = NewLockedBatchingChannel(5)
+	testBatches(t, ch)
+
+	ch = NewLockedBatchingChannel(Infinity)
+	testBatches(t, ch)
+
+	testChannelClose(t, "locked infinite channel", NewLockedInfiniteChannel())
+	testChannelCloseWithError(t, "locked infinite channel", NewLockedInfiniteChannel())
+	testChannelDrain(t, "locked infinite channel", NewLockedInfiniteChannel())
+	testChannelSnapshot(t, "locked infinite channel", NewLockedInfiniteChannel())
+}
+
+func TestLockedChannelSendRecv(t *testing.T) {
+	ch := NewLockedResizableChannel()
+	ch.Resize(Infinity)
+
+	for i := 0; i < 1000; i++ {
+		if err := ch.Send(i); err != nil {
+			t.Fatal("locked channel send failed", err)
+		}
+	}
+	if ch.Len() != 1000 {
+		t.Error("locked channel expected length 1000 but got", ch.Len())
+	}
+	ch.Close()
+	if err := ch.Send(nil); err != ErrClosed {
+		t.Error("locked channel send after close returned", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		val, ok := ch.Recv()
+		if !ok || i != val.(int) {
+			t.Fatal("locked channel expected", i, "but got", val)
+		}
+	}
+	if _, ok := ch.Recv(); ok {
+		t.Error("locked channel received from closed channel")
+	}
+	<-ch.Done()
+}
+
+func TestLockedChannelOverflow(t *testing.T) {
+	ring := NewLockedRingChannel(5)
+	overflow := NewLockedOverflowingChannel(5)
+	for i := 0; i < 10; i++ {
+		ring.Send(i)
+		overflow.Send(i)
+	}
+	if ring.Len() != 5 || overflow.Len() != 5 {
+		t.Error("locked channels overflowed with lengths", ring.Len(), overflow.Len())
+	}
+
+	for i := 0; i < 5; i++ {
+		if val, _ := ring.Recv(); val.(int) != i+5 {
+			t.Error("locked ring channel expected", i+5, "but got", val)
+		}
+	}
+
+	batch, _ := overflow.RecvBatch()
+	for i := range batch {
+		if batch[i].(int) != i {
+			t.Error("locked overflowing channel expected", i, "but got", batch[i])
+		}
+	}
+}
+
+func TestLockedChannelBatchInTransit(t *testing.T) {
+	ch := NewLockedBatchingChannel(2)
+	out := ch.Out()
+	ch.Send(1)
+	ch.Send(2)
+
+	// the buffer is full until the batch taken by the Out() pump has been delivered
+	sent := make(chan struct{})
+	go func() {
+		ch.Send(3)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Error("locked batching channel accepted a value while full")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if ch.Len() > int(ch.Cap()) {
+		t.Error("locked batching channel had length", ch.Len(), "over its capacity", ch.Cap())
+	}
+
+	var values []interface{}
+	values = append(values, (<-out).([]interface{})...)
+	<-sent
+	ch.Close()
+	for batch := range out {
+		values = append(values, batch.([]interface{})...)
+	}
+	if len(values) != 3 || values[0] != 1 || values[1] != 2 || values[2] != 3 {
+		t.Error("locked batching channel delivered", values)
+	}
+}
+
+func TestLockedChannelResizeUnsupported(t *testing.T) {
+	for _, ch := range []*LockedChannel{NewLockedRingChannel(5), NewLockedOverflowingChannel(5)} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("resizing", ch.overflow, "locked channel did not panic")
+				}
+			}()
+			ch.Resize(10)
+		}()
+		if ch.Cap() != 5 {
+			t.Error("locked channel resized to", ch.Cap())
+		}
+	}
+}
+
+func TestLockedChannelWatermarksCap(t *testing.T) {
+	ch := NewLockedResizableChannel()
+	ch.Resize(4)
+	var caps []BufferCap
+	ch.SetWatermarks(&Watermarks{
+		High:   2,
+		Low:    0,
+		OnHigh: func(int) { caps = append(caps, ch.Cap()) },
+		OnLow:  func(int) { caps = append(caps, ch.Cap()) },
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ch.Send(1)
+		ch.Send(2)
+		ch.Recv()
+		ch.Recv()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watermark callback calling Cap deadlocked")
+	}
+	if len(caps) != 2 || caps[0] != 4 || caps[1] != 4 {
+		t.Error("unexpected capacities from callbacks", caps)
+	}
+}
+
+func BenchmarkLockedChannelSerial(b *testing.B) {
+	ch := NewLockedInfiniteChannel()
+	for i := 0; i < b.N; i++ {
+		ch.Send(nil)
+	}
+	for i := 0; i < b.N; i++ {
+		ch.Recv()
+	}
+}
+
+func BenchmarkLockedChannelTickTock(b *testing.B) {
+	ch := NewLockedInfiniteChannel()
+	for i := 0; i < b.N; i++ {
+		ch.Send(nil)
+		ch.Recv()
+	}
+}
+
+func BenchmarkLockedChannelLen(b *testing.B) {
+	ch := NewLockedInfiniteChannel()
+	for i := 0; i < b.N; i++ {
+		ch.Len()
+	}
+}
@@ -0,0 +1,210 @@
+package channels
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives reports about the values passing through a channel, for monitoring. The buffered channel types
+// report to one set with their SetMetrics method; anything else (a native channel, say, or the output of one of
+// the helper functions) can be wrapped with InstrumentIn or InstrumentOut to the same effect.
+//
+// The methods are called from the goroutine doing the work (usually the channel's own), so they must be safe for
+// concurrent use and return quickly. NewExpvarMetrics and PrometheusExporter provide ready-made implementations.
+type Metrics interface {
+	// Enqueued reports that n values were written to the channel.
+	Enqueued(n int)
+	// Dequeued reports that n values were read from the channel (including by Drain).
+	Dequeued(n int)
+	// Dropped reports that n values were discarded, whether by an overflow policy, a TTL, CoDel or
+	// ResizeWithPolicy.
+	Dropped(n int)
+	// BlockedSend reports that a write was kept waiting for the given time. The goroutine-backed types can't see
+	// a writer arrive while their buffer is full, so they report a writer found waiting when room is made as
+	// having waited for as long as the buffer was full, and at most one writer per spell of being full.
+	BlockedSend(d time.Duration)
+	// Length reports the new length of the buffer whenever it changes.
+	Length(n int)
+}
+
+// metricsHook holds the Metrics (if any) a channel reports to. It also keeps running totals of the values read
+// and dropped, for Registry, whether or not there are any Metrics.
+type metricsHook struct {
+	readTotal, dropTotal uint64       // accessed atomically
+	m                    atomic.Value // metricsBox
+}
+
+// metricsBox lets a nil Metrics be stored in an atomic.Value, which only accepts one concrete type.
+type metricsBox struct {
+	Metrics
+}
+
+func (h *metricsHook) set(m Metrics) {
+	h.m.Store(metricsBox{m})
+}
+
+func (h *metricsHook) get() Metrics {
+	box, _ := h.m.Load().(metricsBox)
+	return box.Metrics
+}
+
+func (h *metricsHook) enqueued(n int) {
+	if m := h.get(); m != nil && n > 0 {
+		m.Enqueued(n)
+	}
+}
+
+func (h *metricsHook) dequeued(n int) {
+	atomic.AddUint64(&h.readTotal, uint64(n))
+	if m := h.get(); m != nil && n > 0 {
+		m.Dequeued(n)
+	}
+}
+
+func (h *metricsHook) dropped(n int) {
+	atomic.AddUint64(&h.dropTotal, uint64(n))
+	if m := h.get(); m != nil && n > 0 {
+		m.Dropped(n)
+	}
+}
+
+func (h *metricsHook) blocked(d time.Duration) {
+	if m := h.get(); m != nil {
+		m.BlockedSend(d)
+	}
+}
+
+func (h *metricsHook) length(n int) {
+	if m := h.get(); m != nil {
+		m.Length(n)
+	}
+}
+
+func (h *metricsHook) totals() (read, dropped uint64) {
+	return atomic.LoadUint64(&h.readTotal), atomic.LoadUint64(&h.dropTotal)
+}
+
+// setLength updates a channel's length gauge, reporting the new length if it has changed.
+func (h *metricsHook) setLength(g *lengthGauge, n int) {
+	if n != g.get() {
+		h.length(n)
+	}
+	g.set(n)
+}
+
+// blockTimer measures how long a goroutine-backed channel stops reading its input because its buffer is full,
+// and whether that kept a writer waiting.
+type blockTimer struct {
+	since time.Time
+}
+
+// update must be called each time the channel decides whether to read its input, which is nil while it is
+// blocked. When the channel starts reading again it tries to take a value at once, to find out whether a writer
+// was left waiting. If one was, the writer is reported as blocked and received is true; the caller must then
+// deal with the value (or the input having been closed, if open is false) and decide again.
+func (t *blockTimer) update(input chan interface{}, blocked bool, metrics *metricsHook) (elem interface{}, received, open bool) {
+	if blocked {
+		if t.since.IsZero() {
+			t.since = time.Now()
+		}
+		return nil, false, false
+	}
+	if t.since.IsZero() || input == nil {
+		t.since = time.Time{}
+		return nil, false, false
+	}
+	since := t.since
+	t.since = time.Time{}
+	select {
+	case elem, open = <-input:
+		if open {
+			metrics.blocked(time.Now().Sub(since))
+		}
+		return elem, true, open
+	default:
+		return nil, false, false
+	}
+}
+
+// probe checks, without waiting, whether a writer is being kept waiting while the channel is blocked, taking its
+// value (which the caller must then deal with) if so.
+func (t *blockTimer) probe(input chan interface{}, metrics *metricsHook) (elem interface{}, received, open bool) {
+	select {
+	case elem, open = <-input:
+		if open {
+			metrics.blocked(time.Now().Sub(t.since))
+		}
+		t.since = time.Time{}
+		return elem, true, open
+	default:
+		return nil, false, false
+	}
+}
+
+type instrumentedIn struct {
+	input  chan interface{}
+	target SimpleInChannel
+	closer closeState
+}
+
+// InstrumentIn returns a SimpleInChannel which writes everything written to it on to ch, reporting each value as
+// enqueued, and the time taken by each write to ch which could not complete immediately as a blocked send. If ch
+// is a Buffer its length is reported after each write. Closing the returned channel closes ch once everything
+// written has been passed on.
+//
+// The values pass through a goroutine, so (much as for an unbuffered ResizableChannel) one value at a time may be
+// held in transit.
+func InstrumentIn(ch SimpleInChannel, m Metrics) SimpleInChannel {
+	wrapper := &instrumentedIn{input: make(chan interface{}), target: ch}
+	go wrapper.forward(m)
+	return wrapper
+}
+
+func (ch *instrumentedIn) In() chan<- interface{} {
+	return ch.input
+}
+
+func (ch *instrumentedIn) Close() {
+	ch.closer.close(ch.input, nil)
+}
+
+func (ch *instrumentedIn) forward(m Metrics) {
+	buf, _ := ch.target.(Buffer)
+	for elem := range ch.input {
+		select {
+		case ch.target.In() <- elem:
+		default:
+			start := time.Now()
+			ch.target.In() <- elem
+			m.BlockedSend(time.Now().Sub(start))
+		}
+		m.Enqueued(1)
+		if buf != nil {
+			m.Length(buf.Len())
+		}
+	}
+	ch.target.Close()
+}
+
+type instrumentedOut struct {
+	output chan interface{}
+}
+
+// InstrumentOut returns a SimpleOutChannel which produces everything read from ch, reporting each value as
+// dequeued. The values pass through a goroutine, so one value at a time may be held in transit; the returned
+// channel is closed when ch is.
+func InstrumentOut(ch SimpleOutChannel, m Metrics) SimpleOutChannel {
+	wrapper := &instrumentedOut{output: make(chan interface{})}
+	go func() {
+		for elem := range ch.Out() {
+			wrapper.output <- elem
+			m.Dequeued(1)
+		}
+		close(wrapper.output)
+	}()
+	return wrapper
+}
+
+func (ch *instrumentedOut) Out() <-chan interface{} {
+	return ch.output
+}
@@ -0,0 +1,141 @@
+package channels
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counters is a Metrics which keeps running totals, for the exporters below.
+type counters struct {
+	enqueued, dequeued, dropped uint64
+	blockedSends, blockedNanos  uint64
+	length                      int64
+}
+
+func (c *counters) Enqueued(n int) {
+	atomic.AddUint64(&c.enqueued, uint64(n))
+}
+
+func (c *counters) Dequeued(n int) {
+	atomic.AddUint64(&c.dequeued, uint64(n))
+}
+
+func (c *counters) Dropped(n int) {
+	atomic.AddUint64(&c.dropped, uint64(n))
+}
+
+func (c *counters) BlockedSend(d time.Duration) {
+	atomic.AddUint64(&c.blockedSends, 1)
+	atomic.AddUint64(&c.blockedNanos, uint64(d))
+}
+
+func (c *counters) Length(n int) {
+	atomic.StoreInt64(&c.length, int64(n))
+}
+
+func (c *counters) values() interface{} {
+	return map[string]interface{}{
+		"enqueued":             atomic.LoadUint64(&c.enqueued),
+		"dequeued":             atomic.LoadUint64(&c.dequeued),
+		"dropped":              atomic.LoadUint64(&c.dropped),
+		"blocked_sends":        atomic.LoadUint64(&c.blockedSends),
+		"blocked_send_seconds": time.Duration(atomic.LoadUint64(&c.blockedNanos)).Seconds(),
+		"length":               atomic.LoadInt64(&c.length),
+	}
+}
+
+// NewExpvarMetrics returns a Metrics which publishes its running totals with the expvar package, as a map under
+// the given name with the keys enqueued, dequeued, dropped, blocked_sends, blocked_send_seconds and length.
+// Like expvar.Publish, it panics if the name is already in use.
+func NewExpvarMetrics(name string) Metrics {
+	c := &counters{}
+	expvar.Publish(name, expvar.Func(c.values))
+	return c
+}
+
+// PrometheusExporter collects Metrics for any number of channels, and serves them over HTTP in the Prometheus text
+// exposition format with each channel's name as the "channel" label. For example:
+//
+//	exporter := channels.NewPrometheusExporter()
+//	ch := channels.NewInfiniteChannel()
+//	ch.SetMetrics(exporter.Metrics("jobs"))
+//	http.Handle("/metrics", exporter)
+type PrometheusExporter struct {
+	mu       sync.Mutex
+	channels map[string]*counters
+}
+
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{channels: make(map[string]*counters)}
+}
+
+// Metrics returns the Metrics for the named channel, creating them the first time each name is used.
+func (e *PrometheusExporter) Metrics(name string) Metrics {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := e.channels[name]
+	if c == nil {
+		c = &counters{}
+		e.channels[name] = c
+	}
+	return c
+}
+
+var prometheusFamilies = []struct {
+	name, kind, help string
+	value            func(c *counters) string
+}{
+	{"channels_enqueued_total", "counter", "Values written to the channel.", func(c *counters) string {
+		return strconv.FormatUint(atomic.LoadUint64(&c.enqueued), 10)
+	}},
+	{"channels_dequeued_total", "counter", "Values read from the channel.", func(c *counters) string {
+		return strconv.FormatUint(atomic.LoadUint64(&c.dequeued), 10)
+	}},
+	{"channels_dropped_total", "counter", "Values discarded by the channel.", func(c *counters) string {
+		return strconv.FormatUint(atomic.LoadUint64(&c.dropped), 10)
+	}},
+	{"channels_blocked_sends_total", "counter", "Times writers to the channel were blocked.", func(c *counters) string {
+		return strconv.FormatUint(atomic.LoadUint64(&c.blockedSends), 10)
+	}},
+	{"channels_blocked_send_seconds_total", "counter", "Time writers to the channel spent blocked.", func(c *counters) string {
+		seconds := time.Duration(atomic.LoadUint64(&c.blockedNanos)).Seconds()
+		return strconv.FormatFloat(seconds, 'g', -1, 64)
+	}},
+	{"channels_length", "gauge", "Values buffered in the channel.", func(c *counters) string {
+		return strconv.FormatInt(atomic.LoadInt64(&c.length), 10)
+	}},
+}
+
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.channels))
+	for name := range e.channels {
+		names = append(names, name)
+	}
+	channels := make(map[string]*counters, len(e.channels))
+	for name, c := range e.channels {
+		channels[name] = c
+	}
+	e.mu.Unlock()
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, family := range prometheusFamilies {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, name := range names {
+			fmt.Fprintf(&buf, "%s{channel=\"%s\"} %s\n", family.name, prometheusEscaper.Replace(name), family.value(channels[name]))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
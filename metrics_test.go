@@ -0,0 +1,221 @@
+package channels
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu                          sync.Mutex
+	enqueued, dequeued, dropped int
+	blocked                     int
+	length                      int
+}
+
+func (m *testMetrics) Enqueued(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueued += n
+}
+
+func (m *testMetrics) Dequeued(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dequeued += n
+}
+
+func (m *testMetrics) Dropped(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped += n
+}
+
+func (m *testMetrics) BlockedSend(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocked++
+}
+
+func (m *testMetrics) Length(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.length = n
+}
+
+func (m *testMetrics) check(t *testing.T, name string, enqueued, dequeued, dropped, length int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enqueued != enqueued || m.dequeued != dequeued || m.dropped != dropped || m.length != length {
+		t.Errorf("%s reported %d enqueued, %d dequeued, %d dropped and length %d", name,
+			m.enqueued, m.dequeued, m.dropped, m.length)
+	}
+}
+
+func testChannelMetrics(t *testing.T, name string, ch Channel) {
+	m := &testMetrics{}
+	ch.(interface{ SetMetrics(Metrics) }).SetMetrics(m)
+	for i := 0; i < 5; i++ {
+		ch.In() <- i
+	}
+	<-ch.Out()
+	ch.(Snapshotter).Drain()
+	m.check(t, name, 5, 5, 0, 0)
+	ch.Close()
+}
+
+func TestMetrics(t *testing.T) {
+	testChannelMetrics(t, "infinite channel", NewInfiniteChannel())
+	testChannelMetrics(t, "stack channel", NewStackChannel(Infinity, Block))
+
+	m := &testMetrics{}
+	locked := NewLockedRingChannel(3)
+	locked.SetMetrics(m)
+	for i := 0; i < 5; i++ {
+		locked.Send(i)
+	}
+	locked.Recv()
+	m.check(t, "locked ring channel", 5, 1, 2, 2)
+
+	m = &testMetrics{}
+	ring := NewRingChannel(2)
+	ring.SetMetrics(m)
+	for i := 0; i < 5; i++ {
+		ring.In() <- i
+	}
+	ring.Snapshot()
+	m.check(t, "ring channel", 5, 0, 3, 2)
+
+	m = &testMetrics{}
+	batching := NewBatchingChannel(5)
+	batching.SetMetrics(m)
+	for i := 0; i < 5; i++ {
+		batching.In() <- i
+	}
+	<-batching.Out()
+	batching.Snapshot()
+	m.check(t, "batching channel", 5, 5, 0, 0)
+
+	// filling the buffer and then emptying it doesn't count as a blocked send unless a writer was kept waiting
+	for _, ch := range []Channel{NewResizableChannel(), NewBatchingChannel(1)} {
+		m = &testMetrics{}
+		ch.(interface{ SetMetrics(Metrics) }).SetMetrics(m)
+		ch.In() <- 0
+		ch.(Snapshotter).Snapshot()
+		<-ch.Out()
+		ch.(Snapshotter).Snapshot()
+		m.mu.Lock()
+		if m.blocked != 0 {
+			t.Errorf("%T reported %d blocked sends with no writer waiting", ch, m.blocked)
+		}
+		m.mu.Unlock()
+
+		ch.In() <- 1
+		sent := make(chan struct{})
+		go func() {
+			ch.In() <- 2
+			close(sent)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		<-ch.Out()
+		<-sent
+		ch.(Snapshotter).Snapshot()
+		m.mu.Lock()
+		if m.blocked != 1 {
+			t.Errorf("%T reported %d blocked sends with one writer waiting", ch, m.blocked)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	in, out := &testMetrics{}, &testMetrics{}
+	a := NewNativeChannel(None)
+	b := NewNativeChannel(5)
+	Pipe(InstrumentOut(a, out), InstrumentIn(b, in))
+	for i := 0; i < 5; i++ {
+		a.In() <- i
+	}
+	a.Close()
+	for i := 0; i < 5; i++ {
+		if val := <-b.Out(); val != i {
+			t.Error("instrumented pipe expected", i, "but got", val)
+		}
+	}
+	if _, open := <-b.Out(); open {
+		t.Error("instrumented pipe did not close its output")
+	}
+	out.check(t, "instrumented output", 0, 5, 0, 0)
+	in.mu.Lock()
+	if in.enqueued != 5 || in.blocked != 0 {
+		t.Error("instrumented input reported", in.enqueued, "enqueued and", in.blocked, "blocked sends")
+	}
+	in.mu.Unlock()
+
+	// a write which can't complete at once is a blocked send
+	c := NewNativeChannel(None)
+	wrapped := InstrumentIn(c, in)
+	wrapped.In() <- 5
+	time.Sleep(10 * time.Millisecond)
+	<-c.Out()
+	wrapped.Close()
+	<-c.Out()
+	in.mu.Lock()
+	if in.blocked != 1 {
+		t.Error("instrumented input reported", in.blocked, "blocked sends")
+	}
+	in.mu.Unlock()
+}
+
+// expvar names can only be published once, even if the test is run repeatedly
+var expvarTestRuns int
+
+func TestExpvarMetrics(t *testing.T) {
+	expvarTestRuns++
+	name := "channels_test_metrics_" + strconv.Itoa(expvarTestRuns)
+	m := NewExpvarMetrics(name)
+	m.Enqueued(3)
+	m.Dropped(1)
+	m.Length(2)
+	published := expvar.Get(name).String()
+	for _, expected := range []string{`"enqueued":3`, `"dropped":1`, `"length":2`} {
+		if !strings.Contains(published, expected) {
+			t.Error("expvar metrics published", published)
+		}
+	}
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	exporter := NewPrometheusExporter()
+	ch := NewInfiniteChannel()
+	ch.SetMetrics(exporter.Metrics(`jobs "a"`))
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+	<-ch.Out()
+	ch.Snapshot()
+	exporter.Metrics("idle")
+
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"# TYPE channels_enqueued_total counter\n",
+		`channels_enqueued_total{channel="jobs \"a\""} 3` + "\n",
+		`channels_dequeued_total{channel="jobs \"a\""} 1` + "\n",
+		`channels_length{channel="jobs \"a\""} 2` + "\n",
+		`channels_length{channel="idle"} 0` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("prometheus exporter missing %q in\n%s", expected, body)
+		}
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Error("prometheus exporter served", rec.Header().Get("Content-Type"))
+	}
+	ch.Close()
+}
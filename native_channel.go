@@ -15,8 +15,9 @@ func (ch NativeInChannel) Cap() BufferCap {
 	return BufferCap(cap(ch))
 }
 
+// Close closes the underlying channel; closing it again is a no-op.
 func (ch NativeInChannel) Close() {
-	close(ch)
+	closeNative(ch)
 }
 
 // NativeOutChannel implements the OutChannel interface by wrapping a native go read-only channel.
@@ -59,8 +60,9 @@ func (ch NativeChannel) Cap() BufferCap {
 	return BufferCap(cap(ch))
 }
 
+// Close closes the underlying channel; closing it again is a no-op.
 func (ch NativeChannel) Close() {
-	close(ch)
+	closeNative(ch)
 }
 
 // DeadChannel is a placeholder implementation of the Channel interface with no buffer
@@ -47,3 +47,56 @@ func TestOverflowingChannel(t *testing.T) {
 	ch = NewOverflowingChannel(2)
 	testChannelConcurrentAccessors(t, "overflowing channel", ch)
 }
+
+func TestOverflowingChannelSpillover(t *testing.T) {
+	spill := NewInfiniteChannel()
+	ch := NewOverflowingChannelWithSpillover(10, spill)
+	for i := 0; i < 1000; i++ {
+		ch.In() <- i
+	}
+	ch.Close()
+	for i := 0; i < 10; i++ {
+		val := <-ch.Out()
+		if i != val.(int) {
+			t.Fatal("overflowing channel expected", i, "but got", val.(int))
+		}
+	}
+	spill.Close()
+	for i := 10; i < 1000; i++ {
+		val := <-spill.Out()
+		if i != val.(int) {
+			t.Fatal("overflowing channel spilled", val.(int), "but expected", i)
+		}
+	}
+	if val, open := <-spill.Out(); open {
+		t.Fatal("overflowing channel spilled unexpected value", val)
+	}
+
+	spill = NewInfiniteChannel()
+	ch = NewOverflowingChannelWithSpillover(None, spill)
+	ch.In() <- 0
+	ch.Close()
+	<-ch.Done()
+	spill.Close()
+	if val := <-spill.Out(); val != 0 {
+		t.Fatal("unbuffered overflowing channel spilled", val)
+	}
+}
+
+func BenchmarkOverflowingChannelSerial(b *testing.B) {
+	ch := NewOverflowingChannel(100)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+	}
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+}
+
+func BenchmarkOverflowingChannelTickTock(b *testing.B) {
+	ch := NewOverflowingChannel(100)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+		<-ch.Out()
+	}
+}
@@ -0,0 +1,378 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Pipeline builds a graph of channels (the stages) connected by the helper functions of this package (the edges),
+// checks that it is sound, and starts every helper at once. For example:
+//
+//	p := channels.NewPipeline(nil)
+//	p.Stage("source", source).Stage("parse", parsed).Stage("store", stored).Stage("audit", audited)
+//	p.Pipe("source", "parse").Tee("parse", "store", "audit")
+//	if err := p.Start(); err != nil {
+//		...
+//	}
+//
+// Stages may be any channel; the first stage of each path (the one written to from outside the pipeline) only
+// needs an In method, and the last only an Out method. Every edge closes its outputs once its inputs are closed,
+// so closing the first stages shuts down the whole pipeline in order; Shutdown does exactly that, and waits for
+// every stage to drain.
+//
+// Mistakes in declaring the pipeline are not reported straight away, but by Validate and Start, which list
+// every problem found: unknown or duplicate stage names, stages lacking the In or Out method an edge needs,
+// stages connected to nothing, stages written (or read) by more than one edge, which would close them early (or
+// split their values unpredictably) and should be a Multiplex (or a Tee or Distribute) instead, and cycles.
+type Pipeline struct {
+	registry *Registry
+	stages   map[string]*pipelineStage
+	declared []*pipelineStage
+	edges    []*pipelineEdge
+	problems []string
+	order    []*pipelineStage // topologically sorted by Validate
+	started  bool
+}
+
+type pipelineStage struct {
+	name    string
+	ch      interface{}
+	in, out []*pipelineEdge // the edges writing to and reading from the stage
+}
+
+type pipelineEdge struct {
+	kind     string
+	from, to []*pipelineStage
+	done     chan struct{}
+}
+
+// NewPipeline creates an empty Pipeline. If reg is not nil, Start registers every stage with it under the
+// stage's name, and starts the edges through it, so that the whole pipeline can be inspected while it runs.
+func NewPipeline(reg *Registry) *Pipeline {
+	return &Pipeline{registry: reg, stages: make(map[string]*pipelineStage)}
+}
+
+// Stage declares a channel as a stage of the pipeline with the given name.
+func (p *Pipeline) Stage(name string, ch interface{}) *Pipeline {
+	_, in := ch.(SimpleInChannel)
+	_, out := ch.(SimpleOutChannel)
+	switch {
+	case p.stages[name] != nil:
+		p.problems = append(p.problems, fmt.Sprintf("duplicate stage %q", name))
+	case !in && !out:
+		p.problems = append(p.problems, fmt.Sprintf("stage %q (%T) is not a channel", name, ch))
+	default:
+		s := &pipelineStage{name: name, ch: ch}
+		p.stages[name] = s
+		p.declared = append(p.declared, s)
+	}
+	return p
+}
+
+// Pipe connects two stages as the package-level Pipe would.
+func (p *Pipeline) Pipe(from, to string) *Pipeline {
+	return p.connect("Pipe", []string{from}, []string{to})
+}
+
+// Multiplex connects any number of stages to one as the package-level Multiplex would.
+func (p *Pipeline) Multiplex(to string, from ...string) *Pipeline {
+	return p.connect("Multiplex", from, []string{to})
+}
+
+// Tee connects one stage to any number of others as the package-level Tee would.
+func (p *Pipeline) Tee(from string, to ...string) *Pipeline {
+	return p.connect("Tee", []string{from}, to)
+}
+
+// Distribute connects one stage to any number of others as the package-level Distribute would.
+func (p *Pipeline) Distribute(from string, to ...string) *Pipeline {
+	return p.connect("Distribute", []string{from}, to)
+}
+
+func (p *Pipeline) connect(kind string, from, to []string) *Pipeline {
+	if len(from) == 0 || len(to) == 0 {
+		p.problems = append(p.problems, kind+" with nothing to connect")
+		return p
+	}
+	e := &pipelineEdge{kind: kind, done: make(chan struct{})}
+	for _, name := range from {
+		s := p.stages[name]
+		if s == nil {
+			p.problems = append(p.problems, fmt.Sprintf("%s from unknown stage %q", kind, name))
+			return p
+		} else if _, ok := s.ch.(SimpleOutChannel); !ok {
+			p.problems = append(p.problems, fmt.Sprintf("%s from stage %q, which has no Out method", kind, name))
+			return p
+		}
+		e.from = append(e.from, s)
+	}
+	for _, name := range to {
+		s := p.stages[name]
+		if s == nil {
+			p.problems = append(p.problems, fmt.Sprintf("%s to unknown stage %q", kind, name))
+			return p
+		} else if _, ok := s.ch.(SimpleInChannel); !ok {
+			p.problems = append(p.problems, fmt.Sprintf("%s to stage %q, which has no In method", kind, name))
+			return p
+		}
+		e.to = append(e.to, s)
+	}
+	for _, s := range e.from {
+		s.out = append(s.out, e)
+	}
+	for _, s := range e.to {
+		s.in = append(s.in, e)
+	}
+	p.edges = append(p.edges, e)
+	return p
+}
+
+// String names the edge for a Registry, along the lines of "Tee a -> b, c".
+func (e *pipelineEdge) String() string {
+	return e.kind + " " + stageNames(e.from) + " -> " + stageNames(e.to)
+}
+
+func stageNames(stages []*pipelineStage) string {
+	names := make([]string, len(stages))
+	for i, s := range stages {
+		names[i] = s.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validate checks the pipeline as declared so far, returning an error listing every problem found, or nil.
+func (p *Pipeline) Validate() error {
+	problems := append([]string(nil), p.problems...)
+	for _, s := range p.declared {
+		if len(s.in) == 0 && len(s.out) == 0 {
+			problems = append(problems, fmt.Sprintf("stage %q is not connected", s.name))
+		}
+		if len(s.in) > 1 {
+			problems = append(problems, fmt.Sprintf("stage %q is written by %d edges", s.name, len(s.in)))
+		}
+		if len(s.out) > 1 {
+			problems = append(problems, fmt.Sprintf("stage %q is read by %d edges", s.name, len(s.out)))
+		}
+	}
+
+	// Kahn's algorithm: whatever is left unsorted at the end is on (or downstream of) a cycle. An edge only
+	// counts as sorted once every stage it reads is, and a stage once every edge writing to it is.
+	p.order = p.order[:0]
+	written := make(map[*pipelineStage]int, len(p.declared))
+	unread := make(map[*pipelineEdge]int, len(p.edges))
+	for _, e := range p.edges {
+		unread[e] = len(e.from)
+	}
+	for _, s := range p.declared {
+		written[s] = len(s.in)
+		if written[s] == 0 {
+			p.order = append(p.order, s)
+		}
+	}
+	for i := 0; i < len(p.order); i++ {
+		for _, e := range p.order[i].out {
+			if unread[e]--; unread[e] > 0 {
+				continue
+			}
+			for _, s := range e.to {
+				if written[s]--; written[s] == 0 {
+					p.order = append(p.order, s)
+				}
+			}
+		}
+	}
+	if len(p.order) < len(p.declared) {
+		var cyclic []*pipelineStage
+		for _, s := range p.declared {
+			if written[s] > 0 {
+				cyclic = append(cyclic, s)
+			}
+		}
+		problems = append(problems, "cycle through stages "+stageNames(cyclic))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("channels: invalid pipeline: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Start validates the pipeline and, if it is sound, starts all of its edges. With a Registry it panics, as
+// Register does, if any of the names it registers is already in use.
+func (p *Pipeline) Start() error {
+	if p.started {
+		return errors.New("channels: pipeline already started")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.started = true
+	if p.registry != nil {
+		for _, s := range p.declared {
+			p.registry.Register(s.name, s.ch)
+		}
+	}
+	for _, e := range p.edges {
+		p.startEdge(e)
+	}
+	return nil
+}
+
+func (p *Pipeline) startEdge(e *pipelineEdge) {
+	inputs := make([]SimpleOutChannel, len(e.from))
+	for i, s := range e.from {
+		inputs[i] = s.ch.(SimpleOutChannel)
+	}
+	outputs := make([]SimpleInChannel, len(e.to))
+	for i, s := range e.to {
+		outputs[i] = s.ch.(SimpleInChannel)
+	}
+	run := func() {
+		switch e.kind {
+		case "Pipe":
+			pipe(inputs[0], outputs[0], true)
+		case "Multiplex":
+			multiplex(outputs[0], inputs, true)
+		case "Tee":
+			tee(inputs[0], outputs, true)
+		case "Distribute":
+			distribute(inputs[0], outputs, true)
+		}
+		close(e.done)
+	}
+	if p.registry != nil {
+		p.registry.startHelper(e.String(), e.kind, run)
+	} else {
+		go run()
+	}
+}
+
+// DrainError is returned by Pipeline.Shutdown when its context finishes before every stage has drained.
+type DrainError struct {
+	Stages []string // the stages which had not drained, in topological order
+	Err    error    // the context's error
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("channels: pipeline stages failed to drain: %s (%v)", strings.Join(e.Stages, ", "), e.Err)
+}
+
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
+// drainPollInterval is how often Shutdown checks the length of stages which can't signal that they have drained.
+const drainPollInterval = 10 * time.Millisecond
+
+// Shutdown closes a started pipeline from the top down and waits for it to drain. It goes through the stages in
+// topological order, closing each one which nothing in the pipeline writes to and then waiting until the stage
+// has drained; the edges close the stages further down as their inputs run dry. A stage has drained once it is
+// closed and empty: for a Drainer that is when Done is closed, for anything else when the edges writing to it
+// have finished and (if it is a Buffer) its length has fallen to zero. The final stages only drain as they are
+// read from outside the pipeline, so something must still be reading them.
+//
+// If the context finishes first, Shutdown returns a *DrainError listing the stages which had not drained.
+// First stages without an In method can't be closed by Shutdown, which waits for them to be closed elsewhere.
+// It may be called again (with a new deadline, say) to carry on waiting.
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	if !p.started {
+		return errors.New("channels: pipeline not started")
+	}
+	for i, s := range p.order {
+		if in, ok := s.ch.(SimpleInChannel); ok && len(s.in) == 0 {
+			in.Close()
+		}
+		if err := s.waitDrained(ctx); err != nil {
+			var stages []string
+			for _, s := range p.order[i:] {
+				if !s.drained() {
+					stages = append(stages, s.name)
+				}
+			}
+			if len(stages) == 0 {
+				// everything drained just as the context finished
+				return nil
+			}
+			return &DrainError{Stages: stages, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *pipelineStage) drained() bool {
+	if d, ok := s.ch.(Drainer); ok {
+		select {
+		case <-d.Done():
+			return true
+		default:
+			return false
+		}
+	}
+	for _, e := range s.in {
+		select {
+		case <-e.done:
+		default:
+			return false
+		}
+	}
+	buf, ok := s.ch.(Buffer)
+	return !ok || buf.Len() == 0
+}
+
+func (s *pipelineStage) waitDrained(ctx context.Context) error {
+	var done <-chan struct{}
+	var poll <-chan time.Time
+	if d, ok := s.ch.(Drainer); ok {
+		done = d.Done()
+	} else {
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for !s.drained() {
+		select {
+		case <-done:
+		case <-poll:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteDOT writes the topology of the pipeline to w as a Graphviz DOT digraph, with each stage which is a Buffer
+// labelled with its current length (and capacity, if it is finite), and each edge with the helper it uses.
+// It may be called at any time, before or after Start.
+func (p *Pipeline) WriteDOT(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("digraph pipeline {\n\trankdir=LR;\n")
+	for _, s := range p.declared {
+		label := dotEscaper.Replace(s.name)
+		if b, ok := s.ch.(Buffer); ok {
+			if b.Cap() == Infinity {
+				label += fmt.Sprintf(`\nlen %d`, b.Len())
+			} else {
+				label += fmt.Sprintf(`\nlen %d / %d`, b.Len(), b.Cap())
+			}
+		}
+		fmt.Fprintf(&buf, "\t\"%s\" [shape=box, label=\"%s\"];\n", dotEscaper.Replace(s.name), label)
+	}
+	for _, e := range p.edges {
+		for _, from := range e.from {
+			for _, to := range e.to {
+				fmt.Fprintf(&buf, "\t\"%s\" -> \"%s\" [label=\"%s\"];\n",
+					dotEscaper.Replace(from.name), dotEscaper.Replace(to.name), e.kind)
+			}
+		}
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build go1.13
+// +build go1.13
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDrainErrorUnwrap(t *testing.T) {
+	err := fmt.Errorf("shutting down: %w", &DrainError{Stages: []string{"sink"}, Err: context.DeadlineExceeded})
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		t.Error("DrainError did not unwrap to its cause", err)
+	}
+	var drainErr *DrainError
+	if !errors.As(err, &drainErr) || len(drainErr.Stages) != 1 || drainErr.Stages[0] != "sink" {
+		t.Error("DrainError not found in", err)
+	}
+}
@@ -0,0 +1,240 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	source := NewNativeChannel(None)
+	odd, even := NewInfiniteChannel(), NewInfiniteChannel()
+	merged := NewInfiniteChannel()
+
+	p := NewPipeline(nil)
+	p.Stage("source", source).Stage("odd", odd).Stage("even", even).Stage("merged", merged)
+	p.Stage("spare", NewInfiniteChannel())
+	p.Distribute("source", "odd", "even").Multiplex("merged", "odd", "even")
+	if err := p.Start(); err == nil || !strings.Contains(err.Error(), `stage "spare" is not connected`) {
+		t.Fatal("expected an unconnected stage, got", err)
+	}
+
+	p = NewPipeline(nil)
+	p.Stage("source", source).Stage("odd", odd).Stage("even", even).Stage("merged", merged)
+	p.Distribute("source", "odd", "even").Multiplex("merged", "odd", "even")
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err == nil {
+		t.Error("pipeline started twice")
+	}
+
+	for i := 0; i < 100; i++ {
+		source.In() <- i
+	}
+	source.Close()
+	seen := make(map[interface{}]bool)
+	for elem := range merged.Out() {
+		seen[elem] = true
+	}
+	if len(seen) != 100 {
+		t.Error("expected 100 distinct values, got", len(seen))
+	}
+}
+
+func TestPipelineValidate(t *testing.T) {
+	native := func() Channel { return NewNativeChannel(None) }
+	out := struct{ SimpleOutChannel }{NewInfiniteChannel()}
+
+	p := NewPipeline(nil)
+	p.Stage("a", native()).Stage("b", native()).Stage("c", native()).Stage("d", native())
+	p.Stage("a", native()).Stage("nothing", 42).Stage("out", out)
+	p.Pipe("a", "b").Pipe("b", "c").Pipe("c", "b")
+	p.Tee("c", "d", "d").Pipe("a", "missing").Pipe("a", "out").Multiplex("d")
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("invalid pipeline passed validation")
+	}
+	for _, problem := range []string{
+		`duplicate stage "a"`,
+		`stage "nothing" (int) is not a channel`,
+		`Pipe to unknown stage "missing"`,
+		`Pipe to stage "out", which has no In method`,
+		`Multiplex with nothing to connect`,
+		`stage "out" is not connected`,
+		`stage "b" is written by 2 edges`,
+		`stage "c" is read by 2 edges`,
+		`stage "d" is written by 2 edges`,
+		`cycle through stages b, c, d`,
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q missing from %q", problem, err)
+		}
+	}
+	if p.Start() == nil {
+		t.Error("invalid pipeline started")
+	}
+}
+
+func TestPipelineMultiplexOrder(t *testing.T) {
+	native := func() Channel { return NewNativeChannel(None) }
+
+	p := NewPipeline(nil).Stage("src", native()).Stage("c", native()).Stage("d", native())
+	p.Multiplex("c", "src", "d").Pipe("c", "d")
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "cycle through stages c, d") {
+		t.Error("expected a cycle through the Multiplex, got", err)
+	}
+
+	p = NewPipeline(nil)
+	p.Stage("s1", native()).Stage("s2", native()).Stage("y", native()).Stage("x", native()).Stage("c", native())
+	p.Pipe("s1", "y").Pipe("y", "x").Multiplex("c", "s2", "x")
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if order := stageNames(p.order); order != "s1, s2, y, x, c" {
+		t.Error("expected topological order, got", order)
+	}
+}
+
+func TestPipelineRegistry(t *testing.T) {
+	reg := NewRegistry()
+	in, out := NewNativeChannel(None), NewInfiniteChannel()
+	p := NewPipeline(reg).Stage("in", in).Stage("out", out).Pipe("in", "out")
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	infos := reg.Channels()
+	if len(infos) != 3 || infos[0].Name != "Pipe in -> out" || infos[1].Name != "in" || infos[2].Name != "out" {
+		t.Error("unexpected registry contents", infos)
+	}
+	in.Close()
+	<-out.Done()
+}
+
+func TestPipelineWriteDOT(t *testing.T) {
+	in, out := NewRingChannel(5), NewInfiniteChannel()
+	in.In() <- 1
+	waitForLen(t, "ring", in, 1)
+	p := NewPipeline(nil).Stage("in", in).Stage(`"out"`, out).Stage("sink", NewNativeChannel(None))
+	p.Tee("in", `"out"`, "sink")
+
+	var buf bytes.Buffer
+	if err := p.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph pipeline {
+	rankdir=LR;
+	"in" [shape=box, label="in\nlen 1 / 5"];
+	"\"out\"" [shape=box, label="\"out\"\nlen 0"];
+	"sink" [shape=box, label="sink\nlen 0 / 0"];
+	"in" -> "\"out\"" [label="Tee"];
+	"in" -> "sink" [label="Tee"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected DOT output:\n%s", buf.String())
+	}
+}
+
+func TestPipelineShutdown(t *testing.T) {
+	source, mid := NewInfiniteChannel(), NewInfiniteChannel()
+	left, right := NewInfiniteChannel(), NewNativeChannel(10)
+	p := NewPipeline(nil).Stage("source", source).Stage("mid", mid).Stage("left", left).Stage("right", right)
+	p.Pipe("source", "mid").Tee("mid", "left", "right")
+	if err := p.Shutdown(context.Background()); err == nil {
+		t.Error("unstarted pipeline shut down")
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		source.In() <- i
+	}
+	var wg sync.WaitGroup
+	counts := make([]int, 2)
+	for i, sink := range []SimpleOutChannel{left, right} {
+		wg.Add(1)
+		go func(i int, sink SimpleOutChannel) {
+			defer wg.Done()
+			for _ = range sink.Out() {
+				counts[i]++
+			}
+		}(i, sink)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if counts[0] != 1000 || counts[1] != 1000 {
+		t.Error("values lost in shutdown", counts)
+	}
+}
+
+func TestPipelineShutdownUndrained(t *testing.T) {
+	source, sink := NewNativeChannel(None), NewInfiniteChannel()
+	p := NewPipeline(nil).Stage("source", source).Stage("sink", sink).Pipe("source", "sink")
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	source.In() <- 1
+	source.In() <- 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	drainErr, ok := err.(*DrainError)
+	if !ok {
+		t.Fatal("expected a DrainError, got", err)
+	}
+	if len(drainErr.Stages) != 1 || drainErr.Stages[0] != "sink" || drainErr.Err != context.DeadlineExceeded {
+		t.Error("unexpected DrainError", drainErr)
+	}
+
+	if elem := <-sink.Out(); elem != 1 {
+		t.Error("expected 1, got", elem)
+	}
+	if elem := <-sink.Out(); elem != 2 {
+		t.Error("expected 2, got", elem)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipelineShutdownOrder(t *testing.T) {
+	s1, y, x := NewInfiniteChannel(), NewInfiniteChannel(), NewInfiniteChannel()
+	s2, c := NewInfiniteChannel(), NewNativeChannel(None)
+	p := NewPipeline(nil).Stage("s1", s1).Stage("s2", s2).Stage("y", y).Stage("x", x).Stage("c", c)
+	p.Pipe("s1", "y").Pipe("y", "x").Multiplex("c", "s2", "x")
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		s1.In() <- i
+	}
+
+	// nothing reads c, so the Multiplex blocks and x is left holding values
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	drainErr, ok := err.(*DrainError)
+	if !ok {
+		t.Fatal("expected a DrainError, got", err)
+	}
+	if strings.Join(drainErr.Stages, ", ") != "x, c" {
+		t.Error("expected x and c to be undrained, in that order, got", drainErr.Stages)
+	}
+
+	for i := 0; i < 3; i++ {
+		<-c.Out()
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
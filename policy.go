@@ -0,0 +1,54 @@
+package channels
+
+import "math/rand"
+
+// Policy decides what a PolicyChannel does when a value is written while its buffer is full. Like Storage,
+// a Policy is only called from the channel's own goroutine.
+type Policy interface {
+	// Blocking reports whether writers should wait for room in the buffer. If it returns true,
+	// Overflow is never called.
+	Blocking() bool
+	// Overflow chooses which value to discard when elem is written to a full buffer: either the index of a
+	// buffered value to evict to make room for elem, or -1 to discard elem itself. The index is as for
+	// Storage.Evict, into buffer.Added() (oldest first), which is not the order of buffer.Values() unless the
+	// storage is first in, first out. It is only called when the buffer holds at least one value.
+	Overflow(buffer Storage, elem interface{}) int
+}
+
+// PolicyFunc adapts an ordinary function to the (non-blocking) Policy interface, for custom overflow rules.
+type PolicyFunc func(buffer Storage, elem interface{}) int
+
+func (f PolicyFunc) Blocking() bool {
+	return false
+}
+
+func (f PolicyFunc) Overflow(buffer Storage, elem interface{}) int {
+	return f(buffer, elem)
+}
+
+type blockPolicy struct{}
+
+func (blockPolicy) Blocking() bool {
+	return true
+}
+
+func (blockPolicy) Overflow(buffer Storage, elem interface{}) int {
+	return -1
+}
+
+var (
+	// Block makes writers wait until there is room in the buffer, like InfiniteChannel and ResizableChannel.
+	Block Policy = blockPolicy{}
+	// DropNewest discards the value being written, like OverflowingChannel.
+	DropNewest Policy = PolicyFunc(func(buffer Storage, elem interface{}) int {
+		return -1
+	})
+	// DropOldest evicts the value which was written longest ago, like RingChannel.
+	DropOldest Policy = PolicyFunc(func(buffer Storage, elem interface{}) int {
+		return 0
+	})
+	// DropRandom evicts a buffered value chosen uniformly at random.
+	DropRandom Policy = PolicyFunc(func(buffer Storage, elem interface{}) int {
+		return rand.Intn(buffer.Len())
+	})
+)
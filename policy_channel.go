@@ -0,0 +1,503 @@
+package channels
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// PolicyChannel implements the Channel interface with a buffer whose ordering is determined by a Storage
+// and whose behaviour when full is determined by a Policy, so that (for example) a priority queue can discard
+// its oldest values rather than blocking. InfiniteChannel, ResizableChannel, RingChannel and OverflowingChannel
+// are all presets of the same machinery, using a QueueStorage with the Block, DropOldest and DropNewest policies.
+//
+// A PolicyChannel can be resized (and autoscaled) exactly like a ResizableChannel. With a capacity of None and
+// a blocking policy it holds the single value waiting for a reader, as an unbuffered ResizableChannel does;
+// with a capacity of None and any other policy, values are passed to a waiting reader or else discarded, as by
+// an unbuffered RingChannel or OverflowingChannel.
+//
+// Len() is kept up to date by the channel's goroutine, just after it takes each value from In() or delivers one
+// on Out(), so for a moment after a write or read completes it may not yet reflect it. This applies to all the
+// presets too.
+type PolicyChannel struct {
+	policyBuffer
+}
+
+// NewPolicyChannel creates a PolicyChannel with the given capacity, storage and overflow policy. A nil storage
+// is a QueueStorage and a nil policy is Block. If spill is not nil, values discarded by the policy are written
+// to it rather than being lost, exactly as for NewRingChannelWithSpillover. The storage must be empty, and must
+// not be used for anything else once the channel has been created. It panics if the storage has a Cap() smaller
+// than the capacity (see Storage).
+func NewPolicyChannel(size BufferCap, storage Storage, policy Policy, spill SimpleInChannel) *PolicyChannel {
+	checkSize(size, "NewPolicyChannel")
+	if storage == nil {
+		storage = NewQueueStorage()
+	}
+	if policy == nil {
+		policy = Block
+	}
+	ch := &PolicyChannel{}
+	ch.start(size, storage, policy, spill)
+	return ch
+}
+
+func (ch *PolicyChannel) Resize(newSize BufferCap) {
+	ch.sendResize(resizeRequest{size: newSize, policy: ShrinkKeep})
+}
+
+// ResizeWithPolicy behaves exactly as ResizableChannel.ResizeWithPolicy does, but the values evicted by
+// ShrinkDropOldest and ShrinkDropNewest are those written longest ago and most recently respectively, whatever
+// order the storage reads them in.
+func (ch *PolicyChannel) ResizeWithPolicy(newSize BufferCap, policy ShrinkPolicy) <-chan interface{} {
+	return ch.resizeWithPolicy(newSize, policy)
+}
+
+func (ch *PolicyChannel) WaitResized(ctx context.Context) error {
+	return ch.waitResized(ctx)
+}
+
+func (ch *PolicyChannel) SetAutoscale(policy *AutoscalePolicy) {
+	ch.setAutoscale(policy)
+}
+
+// checkStorageCap panics if the storage can't hold as many values as the capacity allows.
+func checkStorageCap(storage Storage, size BufferCap) {
+	if bounded, ok := storage.(boundedStorage); ok && (size == Infinity || size > bounded.Cap()) {
+		panic("channels: capacity is larger than the storage can hold")
+	}
+}
+
+func checkSize(size BufferCap, constructor string) {
+	if size < 0 && size != Infinity {
+		panic("channels: invalid negative size in " + constructor)
+	}
+}
+
+// policyBuffer is the goroutine-backed buffer shared by PolicyChannel and its presets, which embed it.
+// Each preset exposes whichever of the resizing methods make sense for it.
+type policyBuffer struct {
+	length, capacity lengthGauge
+	expiredCount     uint64 // the counters are accessed atomically, so are kept with the gauges for alignment
+	droppedCount     uint64
+	metrics          metricsHook
+	goroutine        int64 // accessed atomically
+	input, output    chan interface{}
+	storage          Storage
+	policy           Policy
+	size             BufferCap
+	spill            SimpleInChannel
+	ttl              time.Duration
+	expired          SimpleInChannel
+	codel            *codel
+	residence        atomic.Value     // *histogram
+	control          chan interface{} // see the handling in run
+	done             chan struct{}
+	closer           closeState
+}
+
+func (ch *policyBuffer) start(size BufferCap, storage Storage, policy Policy, spill SimpleInChannel) {
+	checkStorageCap(storage, size)
+	ch.input = make(chan interface{})
+	ch.output = make(chan interface{})
+	ch.storage = storage
+	ch.policy = policy
+	ch.size = size
+	ch.spill = spill
+	ch.control = make(chan interface{})
+	ch.done = make(chan struct{})
+	ch.capacity.set(int(size))
+	go ch.run()
+}
+
+func (ch *policyBuffer) In() chan<- interface{} {
+	return ch.input
+}
+
+func (ch *policyBuffer) Out() <-chan interface{} {
+	return ch.output
+}
+
+func (ch *policyBuffer) Len() int {
+	return ch.length.get()
+}
+
+func (ch *policyBuffer) Cap() BufferCap {
+	return BufferCap(ch.capacity.get())
+}
+
+func (ch *policyBuffer) Close() {
+	ch.closer.close(ch.input, nil)
+}
+
+func (ch *policyBuffer) CloseWithError(err error) {
+	ch.closer.close(ch.input, err)
+}
+
+func (ch *policyBuffer) Err() error {
+	return ch.closer.error()
+}
+
+func (ch *policyBuffer) Done() <-chan struct{} {
+	return ch.done
+}
+
+func (ch *policyBuffer) CloseAndWait(ctx context.Context) error {
+	return closeAndWait(ctx, ch, ch.done)
+}
+
+func (ch *policyBuffer) Snapshot() []interface{} {
+	return requestContents(ch.control, ch.done, false)
+}
+
+func (ch *policyBuffer) Drain() []interface{} {
+	return requestContents(ch.control, ch.done, true)
+}
+
+func (ch *policyBuffer) SetWatermarks(marks *Watermarks) {
+	ch.length.watch(marks)
+}
+
+func (ch *policyBuffer) SetMetrics(m Metrics) {
+	ch.metrics.set(m)
+}
+
+func (ch *policyBuffer) inspect() inspection {
+	read, dropped := ch.metrics.totals()
+	return inspection{
+		closed:    ch.closer.isClosed(),
+		read:      read,
+		dropped:   dropped,
+		goroutine: atomic.LoadInt64(&ch.goroutine),
+	}
+}
+
+func (ch *policyBuffer) identify() {
+	requestIdentify(ch.control, ch.done)
+}
+
+func (ch *policyBuffer) resizeWithPolicy(newSize BufferCap, policy ShrinkPolicy) <-chan interface{} {
+	req := resizeRequest{size: newSize, policy: policy, reply: make(chan []interface{}, 1)}
+	var evicted []interface{}
+	if ch.sendResize(req) {
+		evicted = <-req.reply
+	}
+
+	out := make(chan interface{}, len(evicted))
+	for _, elem := range evicted {
+		out <- elem
+	}
+	close(out)
+	return out
+}
+
+func (ch *policyBuffer) waitResized(ctx context.Context) error {
+	waiter := make(chan struct{})
+	select {
+	case ch.control <- waiter:
+	case <-ch.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ch *policyBuffer) setAutoscale(policy *AutoscalePolicy) {
+	if policy != nil {
+		policy.validate()
+		checkStorageCap(ch.storage, policy.Max)
+		copied := *policy
+		policy = &copied
+	}
+	select {
+	case ch.control <- policy:
+	case <-ch.done:
+	}
+}
+
+func (ch *policyBuffer) sendResize(req resizeRequest) bool {
+	if req.size < 0 && req.size != Infinity {
+		panic("channels: invalid negative size trying to resize channel")
+	}
+	checkStorageCap(ch.storage, req.size)
+	select {
+	case ch.control <- req:
+		return true
+	case <-ch.done:
+		return false
+	}
+}
+
+func (ch *policyBuffer) setSize(size BufferCap) {
+	ch.size = size
+	ch.capacity.set(int(size))
+}
+
+// evict removes and returns the n oldest or newest values in the buffer, oldest first, according to policy.
+func (ch *policyBuffer) evict(n int, policy ShrinkPolicy) []interface{} {
+	if n <= 0 || policy == ShrinkKeep {
+		return nil
+	}
+	var evicted []interface{}
+	if newest, ok := ch.storage.(newestEvicter); ok && policy == ShrinkDropNewest {
+		evicted = storedValues(newest.evictNewest(n))
+	} else {
+		evicted = make([]interface{}, n)
+		for i := range evicted {
+			if policy == ShrinkDropOldest {
+				evicted[i] = StoredValue(ch.storage.Evict(0))
+			} else {
+				evicted[n-1-i] = StoredValue(ch.storage.Evict(ch.storage.Len() - 1))
+			}
+		}
+	}
+	ch.metrics.dropped(n)
+	return evicted
+}
+
+// add buffers a value written to the channel, consulting the policy if the buffer is full.
+func (ch *policyBuffer) add(elem interface{}) {
+	if ch.policy.Blocking() || ch.size == Infinity || ch.storage.Len() < int(ch.size) {
+		// a blocking channel only reads its input when there is room
+		ch.storage.Add(ch.stamp(elem))
+		ch.metrics.enqueued(1)
+		return
+	}
+	if ch.storage.Len() == 0 {
+		// an unbuffered channel can still hand the value to a reader which is ready for it
+		select {
+		case ch.output <- elem:
+			ch.metrics.enqueued(1)
+			ch.delivered(ch.stamp(elem))
+		default:
+			ch.discard(elem)
+		}
+		return
+	}
+	for ch.storage.Len() >= int(ch.size) && ch.storage.Len() > 0 {
+		i := ch.policy.Overflow(policyStorage{ch.storage}, elem)
+		if i < 0 {
+			break
+		}
+		ch.discard(StoredValue(ch.storage.Evict(i)))
+	}
+	if ch.storage.Len() < int(ch.size) {
+		ch.storage.Add(ch.stamp(elem))
+		ch.metrics.enqueued(1)
+	} else {
+		ch.discard(elem)
+	}
+}
+
+// discard counts a value displaced by the overflow policy and passes it on to the spill channel, if any.
+func (ch *policyBuffer) discard(elem interface{}) {
+	atomic.AddUint64(&ch.droppedCount, 1)
+	ch.metrics.dropped(1)
+	spillover(ch.spill, elem)
+}
+
+// trimHead discards any values at the head of the buffer which should not be delivered, because they have expired
+// or CoDel says so. It returns the time at which the head needs to be checked again, or the zero time if it doesn't.
+func (ch *policyBuffer) trimHead() time.Time {
+	for ch.storage.Len() > 0 {
+		head := ch.storage.Peek()
+		wake := ch.expiry(head)
+		if wake.IsZero() && ch.codel == nil {
+			return wake
+		}
+		now := time.Now()
+		if !wake.IsZero() && !wake.After(now) {
+			atomic.AddUint64(&ch.expiredCount, 1)
+			ch.metrics.dropped(1)
+			spillover(ch.expired, StoredValue(ch.storage.Remove()))
+			continue
+		}
+		if ch.codel != nil {
+			drop, codelWake := ch.codel.check(now, head.(stamped).at, ch.storage.Len())
+			if drop {
+				atomic.AddUint64(&ch.codel.dropped, 1)
+				ch.metrics.dropped(1)
+				spillover(ch.spill, StoredValue(ch.storage.Remove()))
+				continue
+			}
+			if wake.IsZero() || (!codelWake.IsZero() && codelWake.Before(wake)) {
+				wake = codelWake
+			}
+		}
+		return wake
+	}
+	return time.Time{}
+}
+
+func (ch *policyBuffer) drain() []interface{} {
+	if ch.storage.Len() == 0 {
+		return nil
+	}
+	contents := make([]interface{}, 0, ch.storage.Len())
+	for ch.storage.Len() > 0 {
+		contents = append(contents, StoredValue(ch.storage.Remove()))
+	}
+	ch.metrics.dequeued(len(contents))
+	return contents
+}
+
+func (ch *policyBuffer) run() {
+	var input, output, nextInput chan interface{}
+	var head, next interface{}
+	var waiters []chan struct{}
+	var scaler *autoscaler
+	var tick <-chan time.Time
+	var expiry expiryTimer
+	var blocking blockTimer
+	preferOutput := !ch.policy.Blocking()
+	nextInput = ch.input
+
+	for {
+		expire := expiry.arm(ch.trimHead())
+		if ch.storage.Len() == 0 {
+			output = nil
+			head, next = nil, nil
+		} else {
+			output = ch.output
+			head = ch.storage.Peek()
+			next = StoredValue(head)
+		}
+
+		limit := int(ch.size)
+		if ch.size == None {
+			// an unbuffered channel still has to hold the one value waiting for a reader
+			limit = 1
+		}
+		if ch.policy.Blocking() && ch.size != Infinity && ch.storage.Len() >= limit {
+			input = nil
+		} else {
+			input = nextInput
+		}
+		spell := blocking.since
+		if elem, received, open := blocking.update(input, input == nil && nextInput != nil, &ch.metrics); received {
+			if open {
+				ch.add(elem)
+				if scaler != nil {
+					scaler.blocked(spell, time.Now())
+				}
+			} else {
+				nextInput = nil
+			}
+			continue
+		}
+		ch.metrics.setLength(&ch.length, ch.storage.Len())
+		if scaler != nil {
+			scaler.observe(time.Now(), ch.storage.Len() == 0)
+		}
+
+		if len(waiters) > 0 && (ch.size == Infinity || ch.storage.Len() <= limit) {
+			for _, waiter := range waiters {
+				close(waiter)
+			}
+			waiters = nil
+		}
+
+		if input == nil && output == nil {
+			break
+		}
+
+		if preferOutput && output != nil {
+			// Prefer to write if possible, which is surprisingly effective in reducing
+			// dropped elements due to overflow. The naive read/write select chooses randomly
+			// when both channels are ready, which produces unnecessary drops 50% of the time.
+			select {
+			case output <- next:
+				ch.storage.Remove()
+				ch.delivered(head)
+				continue
+			default:
+			}
+		}
+
+		select {
+		case elem, open := <-input:
+			if open {
+				ch.add(elem)
+			} else {
+				nextInput = nil
+			}
+		case output <- next:
+			ch.storage.Remove()
+			ch.delivered(head)
+		case req := <-ch.control:
+			// everything but the values themselves shares one channel, since each channel in this select
+			// adds to the cost of every value passed through it
+			switch req := req.(type) {
+			case resizeRequest:
+				ch.setSize(req.size)
+				var evicted []interface{}
+				if ch.size != Infinity {
+					evicted = ch.evict(ch.storage.Len()-int(ch.size), req.policy)
+				}
+				if req.reply != nil {
+					req.reply <- evicted
+				}
+			case chan struct{}:
+				waiters = append(waiters, req)
+			case *AutoscalePolicy:
+				if scaler != nil {
+					scaler.stop()
+					scaler, tick = nil, nil
+				}
+				if req != nil {
+					scaler = newAutoscaler(*req)
+					tick = scaler.ticker.C
+					ch.setSize(scaler.evaluate(time.Now(), ch.size, time.Time{}, nil))
+				}
+			case ttlRequest:
+				ch.ttl, ch.expired = req.ttl, req.expired
+			case contentsRequest:
+				var contents []interface{}
+				if req.drain {
+					contents = ch.drain()
+					ch.metrics.setLength(&ch.length, 0)
+				} else {
+					contents = storedValues(ch.storage.Values())
+				}
+				req.reply <- contents
+			case identifyRequest:
+				atomic.StoreInt64(&ch.goroutine, goroutineID())
+			}
+		case now := <-tick:
+			var elem interface{}
+			var received, open bool
+			ch.setSize(scaler.evaluate(now, ch.size, blocking.since, func(grown BufferCap) bool {
+				// only let a writer in if the grown buffer has room for its value
+				if grown != Infinity && ch.storage.Len() >= int(grown) {
+					return false
+				}
+				elem, received, open = blocking.probe(nextInput, &ch.metrics)
+				return received && open
+			}))
+			if received {
+				if open {
+					ch.add(elem)
+				} else {
+					nextInput = nil
+				}
+			}
+		case <-expire:
+			expiry.fired()
+		}
+	}
+
+	if scaler != nil {
+		scaler.stop()
+	}
+	expiry.stop()
+	close(ch.output)
+	close(ch.done)
+	for _, waiter := range waiters {
+		close(waiter)
+	}
+}
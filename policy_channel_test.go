@@ -0,0 +1,198 @@
+package channels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func intLess(a, b interface{}) bool {
+	return a.(int) < b.(int)
+}
+
+func TestPolicyChannel(t *testing.T) {
+	var ch Channel
+
+	ch = NewPolicyChannel(Infinity, nil, nil, nil)
+	testChannel(t, "policy channel", ch)
+
+	ch = NewPolicyChannel(5, NewRingStorage(5), Block, nil)
+	testChannelPair(t, "policy channel", ch, ch)
+
+	ch = NewPolicyChannel(None, nil, Block, nil)
+	testChannel(t, "unbuffered policy channel", ch)
+
+	ch = NewPolicyChannel(5, NewStackStorage(), DropRandom, nil)
+	testChannelConcurrentAccessors(t, "policy channel", ch)
+
+	testChannelClose(t, "policy channel", NewPolicyChannel(5, nil, nil, nil))
+	testChannelCloseWithError(t, "policy channel", NewPolicyChannel(5, nil, nil, nil))
+	testChannelDrain(t, "policy channel", NewPolicyChannel(5, nil, nil, nil))
+	testChannelSnapshot(t, "policy channel", NewPolicyChannel(5, nil, nil, nil))
+}
+
+func TestPolicyChannelBoundedStorage(t *testing.T) {
+	spill := NewInfiniteChannel()
+	ch := NewPolicyChannel(3, NewRingStorage(3), DropOldest, spill)
+	for i := 0; i < 10; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "bounded policy channel", ch, 3)
+	if contents := ch.Drain(); !reflect.DeepEqual(contents, []interface{}{7, 8, 9}) {
+		t.Error("bounded policy channel kept", contents)
+	}
+	waitForLen(t, "bounded policy channel spill", spill, 7)
+
+	// nothing may be given more capacity than the ring has slots
+	for _, bad := range []func(){
+		func() { NewPolicyChannel(10, NewRingStorage(3), DropOldest, nil) },
+		func() { NewPolicyChannel(Infinity, NewRingStorage(3), nil, nil) },
+		func() { ch.Resize(4) },
+		func() {
+			ch.SetAutoscale(&AutoscalePolicy{Min: 1, Max: Infinity, Interval: time.Second, Grow: 0.5, Shrink: 0.5})
+		},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("capacity beyond the storage did not panic")
+				}
+			}()
+			bad()
+		}()
+	}
+	if ch.Cap() != 3 {
+		t.Error("bounded policy channel resized to", ch.Cap())
+	}
+	ch.Close()
+	spill.Close()
+}
+
+func TestPolicyChannelHeapDropOldest(t *testing.T) {
+	spill := NewInfiniteChannel()
+	ch := NewPolicyChannel(3, NewHeapStorage(intLess), DropOldest, spill)
+	for _, i := range []int{5, 1, 4, 2, 3} {
+		ch.In() <- i
+	}
+	waitForLen(t, "heap policy channel", ch, 3)
+
+	// 5 and 1 were the oldest, so they were evicted; the rest come out in priority order
+	if contents := ch.Drain(); len(contents) != 3 || contents[0] != 2 || contents[1] != 3 || contents[2] != 4 {
+		t.Error("heap policy channel contained", contents)
+	}
+	spill.Close()
+	if val := <-spill.Out(); val != 5 {
+		t.Error("heap policy channel spilled", val, "first")
+	}
+	if val := <-spill.Out(); val != 1 {
+		t.Error("heap policy channel spilled", val, "second")
+	}
+	ch.Close()
+}
+
+func TestPolicyChannelStack(t *testing.T) {
+	ch := NewPolicyChannel(Infinity, NewStackStorage(), Block, nil)
+	for i := 0; i < 10; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "stack policy channel", ch, 10)
+	ch.Close()
+	for i := 9; i >= 0; i-- {
+		if val := <-ch.Out(); val != i {
+			t.Fatal("stack policy channel expected", i, "but got", val)
+		}
+	}
+}
+
+func TestPolicyChannelCustomPolicy(t *testing.T) {
+	// keep only even numbers once the buffer is full
+	evens := PolicyFunc(func(buffer Storage, elem interface{}) int {
+		values := buffer.Added()
+		for i := range values {
+			if values[i].(int)%2 == 1 {
+				return i
+			}
+		}
+		return -1
+	})
+	ch := NewPolicyChannel(4, nil, evens, nil)
+	for i := 0; i < 10; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "custom policy channel", ch, 4)
+	ch.Close()
+	for _, expected := range []int{0, 2, 4, 6} {
+		if val := <-ch.Out(); val != expected {
+			t.Error("custom policy channel expected", expected, "but got", val)
+		}
+	}
+}
+
+func TestPolicyChannelCustomPolicyStack(t *testing.T) {
+	// evict the oldest odd number, which is not where Values would put it
+	oldestOdd := PolicyFunc(func(buffer Storage, elem interface{}) int {
+		for i, val := range buffer.Added() {
+			if val.(int)%2 == 1 {
+				return i
+			}
+		}
+		return -1
+	})
+	ch := NewPolicyChannel(3, NewStackStorage(), oldestOdd, nil)
+	for i := 0; i < 5; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "custom policy stack channel", ch, 3)
+	if contents := ch.Drain(); !reflect.DeepEqual(contents, []interface{}{4, 2, 0}) {
+		t.Error("custom policy stack channel kept", contents)
+	}
+}
+
+func TestPolicyChannelDropRandom(t *testing.T) {
+	ch := NewPolicyChannel(10, nil, DropRandom, nil)
+	for i := 0; i < 1000; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "random policy channel", ch, 10)
+	contents := ch.Drain()
+	for i := 1; i < len(contents); i++ {
+		if contents[i].(int) <= contents[i-1].(int) {
+			t.Error("random policy channel reordered values", contents)
+		}
+	}
+	if contents[len(contents)-1] != 999 {
+		t.Error("random policy channel did not keep the newest value", contents)
+	}
+	ch.Close()
+}
+
+func TestPolicyChannelResize(t *testing.T) {
+	ch := NewPolicyChannel(Infinity, NewStackStorage(), Block, nil)
+	for i := 0; i < 5; i++ {
+		ch.In() <- i
+	}
+	evicted := ch.ResizeWithPolicy(2, ShrinkDropOldest)
+	for i := 0; i < 3; i++ {
+		if val := <-evicted; val != i {
+			t.Error("policy channel evicted", val, "but expected", i)
+		}
+	}
+	if err := ch.WaitResized(context.Background()); err != nil {
+		t.Error("policy channel WaitResized returned", err)
+	}
+	if ch.Cap() != 2 || ch.Len() != 2 {
+		t.Error("policy channel resized to", ch.Len(), ch.Cap())
+	}
+	ch.Close()
+}
+
+func BenchmarkPolicyChannelHeapOverflow(b *testing.B) {
+	ch := NewPolicyChannel(100, NewHeapStorage(intLess), DropOldest, nil)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- i
+	}
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+}
@@ -0,0 +1,264 @@
+package channels
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry keeps track of named channels and helpers, so that their state can be inspected while a program is
+// running, which helps to find the stage at fault when a pipeline stalls. Registration is opt-in: channels are
+// added with Register, and the helper functions are registered by calling them as methods of the Registry.
+// A Registry is also an http.Handler which lists everything registered as an HTML table, or as JSON if the
+// request has the query parameter format=json or accepts application/json. For example:
+//
+//	jobs := channels.NewInfiniteChannel()
+//	channels.DefaultRegistry.Register("jobs", jobs)
+//	channels.DefaultRegistry.Pipe("feed", source, jobs)
+//	http.Handle("/debug/channels", channels.DefaultRegistry)
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+}
+
+// DefaultRegistry is a Registry for programs which only need one.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]interface{})}
+}
+
+// ChannelInfo describes the state of a registered channel or helper at the time it was inspected. Type is the Go
+// type of a channel, or the name of a helper function. Len and Cap are zero for anything which is not a Buffer,
+// and Read and Dropped count the values read from and discarded by the types in this package which keep track of
+// them. Goroutine identifies the goroutine a channel or helper runs on, if it has one, as in stack traces; a
+// channel's goroutine is only looked up once it is registered, so it may briefly be reported as 0.
+type ChannelInfo struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Len       int       `json:"len"`
+	Cap       BufferCap `json:"cap"`
+	Closed    bool      `json:"closed"`
+	Read      uint64    `json:"read"`
+	Dropped   uint64    `json:"dropped"`
+	Goroutine int64     `json:"goroutine,omitempty"`
+}
+
+// inspection is the internal state which the types in this package report to a Registry.
+type inspection struct {
+	closed        bool
+	read, dropped uint64
+	goroutine     int64
+}
+
+type inspector interface {
+	inspect() inspection
+}
+
+// identifier is implemented by the channels which only find out which goroutine they run on once registered,
+// since goroutineID is too slow to call for every channel when most are never inspected.
+type identifier interface {
+	identify()
+}
+
+// identifyRequest asks a channel's goroutine to record its identifier.
+type identifyRequest struct{}
+
+// requestIdentify sends an identifyRequest without waiting for it to be taken, since the goroutine may be
+// blocked (on a spillover channel, say) and Register shouldn't be; until it is, the goroutine is reported as 0.
+func requestIdentify(requests chan<- interface{}, done <-chan struct{}) {
+	go func() {
+		select {
+		case requests <- identifyRequest{}:
+		case <-done:
+		}
+	}()
+}
+
+// Register adds a channel (or anything else; SharedBuffer, say) to the registry under the given name.
+// It panics if the name is already in use.
+func (r *Registry) Register(name string, ch interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[name]; ok {
+		panic("channels: duplicate registration of " + strconv.Quote(name))
+	}
+	r.entries[name] = ch
+	if id, ok := ch.(identifier); ok {
+		id.identify()
+	}
+}
+
+// Unregister removes the named entry from the registry, if there is one.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, name)
+}
+
+// Lookup returns the channel or helper registered under the given name, or nil if there is none.
+func (r *Registry) Lookup(name string) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entries[name]
+}
+
+// Channels describes everything in the registry, sorted by name.
+func (r *Registry) Channels() []ChannelInfo {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	entries := make([]interface{}, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		entries[i] = r.entries[name]
+	}
+	r.mu.Unlock()
+
+	infos := make([]ChannelInfo, len(names))
+	for i, entry := range entries {
+		infos[i] = describe(names[i], entry)
+	}
+	return infos
+}
+
+func describe(name string, entry interface{}) ChannelInfo {
+	info := ChannelInfo{Name: name, Type: fmt.Sprintf("%T", entry)}
+	if h, ok := entry.(*helper); ok {
+		info.Type = h.kind
+	}
+	if buf, ok := entry.(Buffer); ok {
+		info.Len = buf.Len()
+		info.Cap = buf.Cap()
+	}
+	if ins, ok := entry.(inspector); ok {
+		state := ins.inspect()
+		info.Closed = state.closed
+		info.Read = state.read
+		info.Dropped = state.dropped
+		info.Goroutine = state.goroutine
+	} else if dr, ok := entry.(Drainer); ok {
+		select {
+		case <-dr.Done():
+			info.Closed = true
+		default:
+		}
+	}
+	return info
+}
+
+// helper is the registry entry for a helper function started through a Registry. Helpers don't buffer or count
+// anything, so all there is to report is the goroutine they run on and whether they have finished.
+type helper struct {
+	kind      string
+	goroutine int64 // accessed atomically
+	finished  int32 // accessed atomically
+}
+
+func (h *helper) inspect() inspection {
+	return inspection{
+		closed:    atomic.LoadInt32(&h.finished) != 0,
+		goroutine: atomic.LoadInt64(&h.goroutine),
+	}
+}
+
+func (r *Registry) startHelper(name, kind string, run func()) {
+	h := &helper{kind: kind}
+	r.Register(name, h)
+	go func() {
+		atomic.StoreInt64(&h.goroutine, goroutineID())
+		run()
+		atomic.StoreInt32(&h.finished, 1)
+	}()
+}
+
+// Pipe behaves exactly like the package-level Pipe, with the helper registered under the given name.
+func (r *Registry) Pipe(name string, input SimpleOutChannel, output SimpleInChannel) {
+	r.startHelper(name, "Pipe", func() {
+		pipe(input, output, true)
+	})
+}
+
+// Multiplex behaves exactly like the package-level Multiplex, with the helper registered under the given name.
+func (r *Registry) Multiplex(name string, output SimpleInChannel, inputs ...SimpleOutChannel) {
+	if len(inputs) == 0 {
+		panic("channels: Multiplex requires at least one input")
+	}
+	r.startHelper(name, "Multiplex", func() {
+		multiplex(output, inputs, true)
+	})
+}
+
+// Tee behaves exactly like the package-level Tee, with the helper registered under the given name.
+func (r *Registry) Tee(name string, input SimpleOutChannel, outputs ...SimpleInChannel) {
+	if len(outputs) == 0 {
+		panic("channels: Tee requires at least one output")
+	}
+	r.startHelper(name, "Tee", func() {
+		tee(input, outputs, true)
+	})
+}
+
+// Distribute behaves exactly like the package-level Distribute, with the helper registered under the given name.
+func (r *Registry) Distribute(name string, input SimpleOutChannel, outputs ...SimpleInChannel) {
+	if len(outputs) == 0 {
+		panic("channels: Distribute requires at least one output")
+	}
+	r.startHelper(name, "Distribute", func() {
+		distribute(input, outputs, true)
+	})
+}
+
+// goroutineID returns the identifier of the calling goroutine, as it appears in stack traces. The runtime
+// deliberately doesn't expose it, so it has to be parsed out of the first line of a stack trace.
+func goroutineID() int64 {
+	var buf [64]byte
+	line := buf[:runtime.Stack(buf[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		line = line[:i]
+	}
+	id, _ := strconv.ParseInt(string(line), 10, 64)
+	return id
+}
+
+var registryPage = template.Must(template.New("registry").Parse(`<!DOCTYPE html>
+<html>
+<head><title>channels</title></head>
+<body>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Type</th><th>Len</th><th>Cap</th><th>State</th><th>Read</th><th>Dropped</th><th>Goroutine</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Len}}</td><td>{{.Cap}}</td><td>{{if .Closed}}closed{{else}}open{{end}}</td><td>{{.Read}}</td><td>{{.Dropped}}</td><td>{{if .Goroutine}}{{.Goroutine}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	infos := r.Channels()
+	var buf bytes.Buffer
+	if req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(&buf).Encode(infos); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := registryPage.Execute(&buf, infos); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,136 @@
+package channels
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	ring := NewRingChannel(2)
+	reg.Register("ring", ring)
+	reg.Register("native", NewNativeChannel(5))
+
+	for i := 0; i < 5; i++ {
+		ring.In() <- i
+	}
+	<-ring.Out()
+	ring.Snapshot()
+
+	infos := reg.Channels()
+	if len(infos) != 2 || infos[0].Name != "native" || infos[1].Name != "ring" {
+		t.Fatalf("unexpected registry contents %+v", infos)
+	}
+	info := infos[1]
+	if info.Type != "*channels.RingChannel" || info.Len != 1 || info.Cap != 2 || info.Closed {
+		t.Error("unexpected ring channel info", info)
+	}
+	if info.Read != 1 || info.Dropped != 3 {
+		t.Error("expected 1 read and 3 dropped, got", info.Read, info.Dropped)
+	}
+	if infos[0].Cap != 5 || infos[0].Goroutine != 0 {
+		t.Error("unexpected native channel info", infos[0])
+	}
+
+	// the goroutine is looked up in the background once registered, and not at all otherwise
+	deadline := time.Now().Add(time.Second)
+	for reg.Channels()[1].Goroutine <= 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("ring channel's goroutine never identified")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	unregistered := NewRingChannel(2)
+	unregistered.Snapshot()
+	if id := unregistered.inspect().goroutine; id != 0 {
+		t.Error("unregistered channel looked up its goroutine", id)
+	}
+	unregistered.Close()
+
+	ring.Close()
+	if !reg.Channels()[1].Closed {
+		t.Error("closed channel reported as open")
+	}
+
+	reg.Unregister("native")
+	if reg.Lookup("native") != nil || reg.Lookup("ring") != ring {
+		t.Error("Unregister removed the wrong entry")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("duplicate registration did not panic")
+		}
+	}()
+	reg.Register("ring", ring)
+}
+
+func TestRegistryHelpers(t *testing.T) {
+	reg := NewRegistry()
+	in := NewNativeChannel(None)
+	out := NewInfiniteChannel()
+	reg.Pipe("pipe", in, out)
+
+	in.In() <- 1
+	<-out.Out()
+	info := reg.Channels()[0]
+	if info.Type != "Pipe" || info.Closed || info.Goroutine <= 0 {
+		t.Error("unexpected running helper info", info)
+	}
+
+	in.Close()
+	<-out.Done()
+	for !reg.Channels()[0].Closed {
+		time.Sleep(time.Millisecond)
+	}
+
+	multi := NewInfiniteChannel()
+	reg.Multiplex("multiplex", multi, NewNativeChannel(None))
+	reg.Tee("tee", NewNativeChannel(None), NewInfiniteChannel())
+	reg.Distribute("distribute", NewNativeChannel(None), NewInfiniteChannel())
+	if len(reg.Channels()) != 4 {
+		t.Error("expected 4 registered helpers, got", reg.Channels())
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	ch := NewInfiniteChannel()
+	ch.In() <- 1
+	waitForLen(t, "registry", ch, 1)
+	reg.Register("jobs <a>", ch)
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/channels?format=json", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Error("unexpected content type", ct)
+	}
+	var infos []ChannelInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "jobs <a>" || infos[0].Len != 1 || infos[0].Cap != Infinity {
+		t.Error("unexpected JSON", rec.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/debug/channels", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, req)
+	if !strings.HasPrefix(rec.Body.String(), "[{") {
+		t.Error("Accept header did not select JSON", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/channels", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Error("unexpected content type", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, "<td>jobs &lt;a&gt;</td>") || !strings.Contains(body, "<td>open</td>") {
+		t.Error("unexpected HTML", body)
+	}
+}
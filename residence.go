@@ -0,0 +1,142 @@
+package channels
+
+import (
+	"sync"
+	"time"
+)
+
+// ResidenceStats summarises how long values spent in a channel's buffer, from being written to In() until being
+// read from Out(). The percentiles come from a histogram with eight buckets per power of two, so they may
+// overstate the true value by up to an eighth; Min and Max are exact.
+type ResidenceStats struct {
+	Count         uint64
+	Min, Max      time.Duration
+	P50, P95, P99 time.Duration
+}
+
+// SetResidenceTracking starts (or stops) recording how long each value spends in the buffer, for ResidenceStats.
+// Only values written while tracking is enabled are recorded, and disabling it discards what has been recorded.
+// Tracking costs a small allocation for every value written.
+func (ch *policyBuffer) SetResidenceTracking(enabled bool) {
+	if !enabled {
+		ch.residence.Store((*histogram)(nil))
+	} else if ch.tracker() == nil {
+		ch.residence.Store(&histogram{})
+	}
+}
+
+// ResidenceStats returns the distribution of time spent in the buffer by values read since residence tracking
+// was enabled with SetResidenceTracking; all zero if it is not enabled.
+func (ch *policyBuffer) ResidenceStats() ResidenceStats {
+	if h := ch.tracker(); h != nil {
+		return h.stats()
+	}
+	return ResidenceStats{}
+}
+
+func (ch *policyBuffer) tracker() *histogram {
+	h, _ := ch.residence.Load().(*histogram)
+	return h
+}
+
+// delivered accounts for a stored value which has just been read, recording its residence time if tracking
+// is enabled.
+func (ch *policyBuffer) delivered(stored interface{}) {
+	ch.metrics.dequeued(1)
+	if h := ch.tracker(); h != nil {
+		if s, ok := stored.(stamped); ok {
+			h.record(time.Now().Sub(s.at))
+		}
+	}
+}
+
+const histogramSubBuckets = 8
+
+// histogram counts durations in logarithmic buckets: durations below histogramSubBuckets nanoseconds each have
+// their own bucket, and every power of two above that is split into histogramSubBuckets equal buckets.
+type histogram struct {
+	mu       sync.Mutex
+	buckets  [64 * histogramSubBuckets]uint64
+	count    uint64
+	min, max time.Duration
+}
+
+// histogramBucket returns the index of the bucket holding d.
+func histogramBucket(d time.Duration) int {
+	if d < histogramSubBuckets {
+		if d < 0 {
+			return 0
+		}
+		return int(d)
+	}
+	exp := uint(0)
+	for v := uint64(d); v > 1; v >>= 1 {
+		exp++
+	}
+	// the top bit is implied by exp, the next three choose the sub-bucket
+	sub := int(uint64(d)>>(exp-3)) - histogramSubBuckets
+	return int(exp-2)*histogramSubBuckets + sub
+}
+
+// histogramBound returns the largest duration held by a bucket.
+func histogramBound(bucket int) time.Duration {
+	if bucket < histogramSubBuckets {
+		return time.Duration(bucket)
+	}
+	exp := uint(bucket/histogramSubBuckets + 2)
+	sub := uint64(bucket % histogramSubBuckets)
+	lower := (histogramSubBuckets + sub) << (exp - 3)
+	return time.Duration(lower + 1<<(exp-3) - 1)
+}
+
+func (h *histogram) record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.buckets[histogramBucket(d)]++
+}
+
+// percentile must be called with the lock held.
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := uint64(p*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for bucket, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			d := histogramBound(bucket)
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) stats() ResidenceStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return ResidenceStats{}
+	}
+	return ResidenceStats{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		P50:   h.percentile(0.50),
+		P95:   h.percentile(0.95),
+		P99:   h.percentile(0.99),
+	}
+}
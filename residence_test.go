@@ -0,0 +1,69 @@
+package channels
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for d := time.Duration(0); d < time.Hour; d = d*3/2 + 1 {
+		bucket := histogramBucket(d)
+		if bound := histogramBound(bucket); bound < d || bound > d+d/histogramSubBuckets {
+			t.Error("duration", d, "in bucket", bucket, "with bound", bound)
+		}
+		if bucket > 0 && histogramBound(bucket-1) >= d {
+			t.Error("duration", d, "belongs below bucket", bucket)
+		}
+	}
+}
+
+func TestResidenceStats(t *testing.T) {
+	ch := NewInfiniteChannel()
+	if stats := ch.ResidenceStats(); stats.Count != 0 {
+		t.Error("untracked channel reported", stats)
+	}
+
+	// values written before tracking starts aren't counted
+	ch.In() <- -1
+	ch.Snapshot()
+	ch.SetResidenceTracking(true)
+	for i := 0; i < 100; i++ {
+		ch.In() <- i
+	}
+	time.Sleep(10 * time.Millisecond)
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+
+	stats := ch.ResidenceStats()
+	if stats.Count != 100 {
+		t.Error("tracked channel counted", stats.Count, "values")
+	}
+	if stats.Min < 10*time.Millisecond || stats.Min > stats.P50 || stats.P50 > stats.P95 ||
+		stats.P95 > stats.P99 || stats.P99 > stats.Max {
+		t.Error("tracked channel reported", stats)
+	}
+
+	ch.SetResidenceTracking(false)
+	if stats := ch.ResidenceStats(); stats.Count != 0 {
+		t.Error("channel reported", stats, "after tracking stopped")
+	}
+}
+
+func TestResidencePercentiles(t *testing.T) {
+	h := &histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	stats := h.stats()
+	check := func(name string, got, expected time.Duration) {
+		if got < expected || got > expected+expected/histogramSubBuckets {
+			t.Error(name, "expected about", expected, "but got", got)
+		}
+	}
+	check("min", stats.Min, time.Millisecond)
+	check("p50", stats.P50, 500*time.Millisecond)
+	check("p95", stats.P95, 950*time.Millisecond)
+	check("p99", stats.P99, 990*time.Millisecond)
+	check("max", stats.Max, time.Second)
+}
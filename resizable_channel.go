@@ -1,109 +1,70 @@
 package channels
 
-import "github.com/eapache/queue"
+import "context"
 
 // ResizableChannel implements the Channel interface with a resizable buffer between the input and the output.
 // The channel initially has a buffer size of 1, but can be resized by calling Resize().
 //
-// Resizing to a buffer capacity of None is, unfortunately, not supported and will panic
-// (see https://github.com/eapache/channels/issues/1).
-// Resizing back and forth between a finite and infinite buffer is fully supported.
+// Resizing back and forth between a finite and infinite buffer is fully supported, as is resizing to and from
+// a buffer capacity of None (see https://github.com/eapache/channels/issues/1). Since values pass through the
+// channel's goroutine, an unbuffered ResizableChannel is not a true rendezvous: one value at a time is accepted
+// from a writer (whose send completes at once) and held, counted by Len(), until a reader takes it; all other
+// writers block until then.
+//
+// Shrinking the buffer (to None or otherwise) with Resize never discards values: anything already buffered
+// beyond the new capacity is still delivered in order, and writers block until enough has been read to make room
+// (WaitResized waits for that to happen). ResizeWithPolicy can instead evict the excess values immediately.
+//
+// It is a PolicyChannel with a QueueStorage and the Block policy.
 type ResizableChannel struct {
-	input, output    chan interface{}
-	length           chan int
-	capacity, resize chan BufferCap
-	size             BufferCap
-	buffer           *queue.Queue
+	policyBuffer
 }
 
 func NewResizableChannel() *ResizableChannel {
-	ch := &ResizableChannel{
-		input:    make(chan interface{}),
-		output:   make(chan interface{}),
-		length:   make(chan int),
-		capacity: make(chan BufferCap),
-		resize:   make(chan BufferCap),
-		size:     1,
-		buffer:   queue.New(),
-	}
-	go ch.magicBuffer()
+	ch := &ResizableChannel{}
+	ch.start(1, NewQueueStorage(), Block, nil)
 	return ch
 }
 
-func (ch *ResizableChannel) In() chan<- interface{} {
-	return ch.input
-}
+// ShrinkPolicy determines what ResizeWithPolicy does with buffered values beyond the new capacity.
+type ShrinkPolicy int
 
-func (ch *ResizableChannel) Out() <-chan interface{} {
-	return ch.output
-}
+const (
+	// ShrinkKeep keeps the excess values, exactly as Resize does.
+	ShrinkKeep ShrinkPolicy = iota
+	// ShrinkDropOldest evicts the oldest values (those which would otherwise be read next).
+	ShrinkDropOldest
+	// ShrinkDropNewest evicts the newest values (those which would otherwise be read last).
+	ShrinkDropNewest
+)
 
-func (ch *ResizableChannel) Len() int {
-	return <-ch.length
+type resizeRequest struct {
+	size   BufferCap
+	policy ShrinkPolicy
+	reply  chan []interface{}
 }
 
-func (ch *ResizableChannel) Cap() BufferCap {
-	val, open := <-ch.capacity
-	if open {
-		return val
-	} else {
-		return ch.size
-	}
+func (ch *ResizableChannel) Resize(newSize BufferCap) {
+	ch.sendResize(resizeRequest{size: newSize, policy: ShrinkKeep})
 }
 
-func (ch *ResizableChannel) Close() {
-	close(ch.input)
+// ResizeWithPolicy resizes the channel like Resize, but if the buffer holds more values than the new capacity
+// allows, the excess is evicted according to policy. The evicted values are returned, oldest first, on a closed
+// channel which is already buffered with all of them; simply ignore it if they are to be discarded.
+func (ch *ResizableChannel) ResizeWithPolicy(newSize BufferCap, policy ShrinkPolicy) <-chan interface{} {
+	return ch.resizeWithPolicy(newSize, policy)
 }
 
-func (ch *ResizableChannel) Resize(newSize BufferCap) {
-	if newSize == None {
-		panic("channels: ResizableChannel does not support unbuffered behaviour")
-	}
-	if newSize < 0 && newSize != Infinity {
-		panic("channels: invalid negative size trying to resize channel")
-	}
-	ch.resize <- newSize
+// WaitResized blocks until the buffer holds no more values than its current capacity allows (so that
+// writers are no longer blocked by an earlier shrink), or until ctx is done.
+func (ch *ResizableChannel) WaitResized(ctx context.Context) error {
+	return ch.waitResized(ctx)
 }
 
-func (ch *ResizableChannel) magicBuffer() {
-	var input, output, nextInput chan interface{}
-	var next interface{}
-	nextInput = ch.input
-	input = nextInput
-
-	for input != nil || output != nil {
-		select {
-		case elem, open := <-input:
-			if open {
-				ch.buffer.Add(elem)
-			} else {
-				input = nil
-				nextInput = nil
-			}
-		case output <- next:
-			ch.buffer.Remove()
-		case ch.size = <-ch.resize:
-		case ch.length <- ch.buffer.Length():
-		case ch.capacity <- ch.size:
-		}
-
-		if ch.buffer.Length() == 0 {
-			output = nil
-			next = nil
-		} else {
-			output = ch.output
-			next = ch.buffer.Peek()
-		}
-
-		if ch.size != Infinity && ch.buffer.Length() >= int(ch.size) {
-			input = nil
-		} else {
-			input = nextInput
-		}
-	}
-
-	close(ch.output)
-	close(ch.resize)
-	close(ch.length)
-	close(ch.capacity)
+// SetAutoscale enables automatic tuning of the channel's capacity according to policy, replacing any previous
+// policy; a nil policy disables it. The capacity is immediately brought within the policy's bounds. Calls to
+// Resize remain possible, but will be overridden the next time the policy is evaluated.
+// It panics if the policy is invalid.
+func (ch *ResizableChannel) SetAutoscale(policy *AutoscalePolicy) {
+	ch.setAutoscale(policy)
 }
@@ -1,8 +1,11 @@
 package channels
 
 import (
+	"context"
 	"math/rand"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestResizableChannel(t *testing.T) {
@@ -30,10 +33,57 @@ func TestResizableChannel(t *testing.T) {
 	ch.Resize(5)
 	testChannelPair(t, "5-buffer resizable channel", ch, ch)
 
+	ch = NewResizableChannel()
+	ch.Resize(None)
+	testChannel(t, "unbuffered resizable channel", ch)
+
+	ch = NewResizableChannel()
+	ch.Resize(None)
+	testChannelPair(t, "unbuffered resizable channel", ch, ch)
+
 	ch = NewResizableChannel()
 	testChannelConcurrentAccessors(t, "resizable channel", ch)
 }
 
+func TestResizableChannelUnbuffered(t *testing.T) {
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+
+	// shrinking keeps what is already buffered, but accepts nothing more until it has been read
+	ch.Resize(None)
+	if ch.Cap() != None {
+		t.Error("resizable channel expected capacity None but got", ch.Cap())
+	}
+	if status := TrySend(ch, 3); status != TimedOut {
+		t.Error("shrunk resizable channel accepted value with status", status)
+	}
+	for i := 0; i < 3; i++ {
+		if val := <-ch.Out(); val.(int) != i {
+			t.Error("resizable channel expected", i, "but got", val)
+		}
+	}
+
+	// one value is accepted and held until a reader arrives, then writers block
+	ch.In() <- 3
+	waitForLen(t, "unbuffered resizable channel", ch, 1)
+	if status := TrySend(ch, 4); status != TimedOut {
+		t.Error("unbuffered resizable channel accepted second value with status", status)
+	}
+
+	ch.Resize(5)
+	for i := 4; i < 8; i++ {
+		ch.In() <- i
+	}
+	for i := 3; i < 8; i++ {
+		if val := <-ch.Out(); val.(int) != i {
+			t.Error("resizable channel expected", i, "but got", val)
+		}
+	}
+}
+
 func TestResizableChannelOnline(t *testing.T) {
 	stopper := make(chan bool)
 	ch := NewResizableChannel()
@@ -59,3 +109,194 @@ func TestResizableChannelOnline(t *testing.T) {
 		}
 	}
 }
+
+func TestResizableChannelShrinkPolicy(t *testing.T) {
+	for _, policy := range []ShrinkPolicy{ShrinkKeep, ShrinkDropOldest, ShrinkDropNewest} {
+		ch := NewResizableChannel()
+		ch.Resize(5)
+		for i := 0; i < 5; i++ {
+			ch.In() <- i
+		}
+
+		var evicted []interface{}
+		for elem := range ch.ResizeWithPolicy(2, policy) {
+			evicted = append(evicted, elem)
+		}
+		ch.Close()
+		remaining := ch.Drain()
+
+		var expectEvicted, expectRemaining []interface{}
+		switch policy {
+		case ShrinkKeep:
+			expectRemaining = []interface{}{0, 1, 2, 3, 4}
+		case ShrinkDropOldest:
+			expectEvicted = []interface{}{0, 1, 2}
+			expectRemaining = []interface{}{3, 4}
+		case ShrinkDropNewest:
+			expectEvicted = []interface{}{2, 3, 4}
+			expectRemaining = []interface{}{0, 1}
+		}
+		if !reflect.DeepEqual(evicted, expectEvicted) {
+			t.Error("policy", policy, "expected to evict", expectEvicted, "but evicted", evicted)
+		}
+		if !reflect.DeepEqual(remaining, expectRemaining) {
+			t.Error("policy", policy, "expected to keep", expectRemaining, "but kept", remaining)
+		}
+	}
+}
+
+func TestResizableChannelWaitResized(t *testing.T) {
+	ch := NewResizableChannel()
+	ch.Resize(5)
+	for i := 0; i < 5; i++ {
+		ch.In() <- i
+	}
+	ch.Resize(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ch.WaitResized(ctx); err != context.DeadlineExceeded {
+		t.Error("resizable channel shrank without a reader, got", err)
+	}
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			<-ch.Out()
+		}
+	}()
+	if err := ch.WaitResized(context.Background()); err != nil {
+		t.Error("resizable channel failed to shrink", err)
+	}
+	if ch.Len() > 2 {
+		t.Error("resizable channel still had", ch.Len(), "values after shrinking")
+	}
+}
+
+func TestResizableChannelAutoscale(t *testing.T) {
+	ch := NewResizableChannel()
+	events := make(chan CapacityChange, 100)
+	ch.SetAutoscale(&AutoscalePolicy{
+		Min:      2,
+		Max:      16,
+		Interval: time.Millisecond,
+		Grow:     0.5,
+		Shrink:   0.5,
+		Events:   events,
+	})
+	if ch.Cap() != 2 {
+		t.Error("autoscaled channel expected capacity 2 but got", ch.Cap())
+	}
+
+	// a producer with no consumer keeps the buffer full, so it grows to the maximum
+	go func() {
+		for i := 0; i < 100; i++ {
+			ch.In() <- i
+		}
+	}()
+	waitForCap(t, ch, 16)
+
+	// a consumer with no producer keeps the buffer empty, so it shrinks to the minimum
+	for i := 0; i < 100; i++ {
+		if val := <-ch.Out(); val.(int) != i {
+			t.Fatal("autoscaled channel expected", i, "but got", val)
+		}
+	}
+	waitForCap(t, ch, 2)
+
+	ch.SetAutoscale(nil)
+	ch.Resize(7)
+	time.Sleep(5 * time.Millisecond)
+	if ch.Cap() != 7 {
+		t.Error("channel kept autoscaling after it was disabled")
+	}
+
+	if event := <-events; event.Old != 1 || event.New != 2 {
+		t.Error("unexpected first autoscaling event", event)
+	}
+}
+
+func TestResizableChannelAutoscaleIdleFull(t *testing.T) {
+	// a full buffer which no writer is waiting on is not a reason to grow
+	ch := NewResizableChannel()
+	ch.SetAutoscale(&AutoscalePolicy{Min: 2, Max: 16, Interval: time.Millisecond, Grow: 0.5, Shrink: 0.5})
+	ch.In() <- 0
+	ch.In() <- 1
+	time.Sleep(20 * time.Millisecond)
+	if ch.Cap() != 2 {
+		t.Error("autoscaled channel grew to", ch.Cap(), "with no writer waiting")
+	}
+
+	// but it grows once one is
+	go func() {
+		ch.In() <- 2
+	}()
+	waitForCap(t, ch, 4)
+	waitForLen(t, "autoscaled channel", ch, 3)
+	ch.SetAutoscale(nil)
+	ch.Close()
+}
+
+func TestAutoscalePolicyFractions(t *testing.T) {
+	for _, fractions := range [][2]float64{{0, 0}, {0, 0.5}, {0.5, 0}, {1.5, 0.5}, {0.5, -1}} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("autoscale policy with Grow and Shrink", fractions, "did not panic")
+				}
+			}()
+			NewResizableChannel().SetAutoscale(&AutoscalePolicy{
+				Min: 1, Max: 8, Interval: time.Second, Grow: fractions[0], Shrink: fractions[1],
+			})
+		}()
+	}
+	ch := NewResizableChannel()
+	ch.SetAutoscale(&AutoscalePolicy{Min: 1, Max: 8, Interval: time.Second, Grow: 1, Shrink: 1})
+	ch.SetAutoscale(nil)
+	ch.Close()
+}
+
+func waitForCap(t *testing.T, ch *ResizableChannel, expected BufferCap) {
+	for deadline := time.Now().Add(time.Second); ch.Cap() != expected; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("autoscaled channel expected capacity", expected, "but got", ch.Cap())
+		}
+	}
+}
+
+func BenchmarkResizableChannelParallel(b *testing.B) {
+	ch := NewResizableChannel()
+	ch.Resize(100)
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			<-ch.Out()
+		}
+		ch.Close()
+	}()
+	for i := 0; i < n; i++ {
+		ch.In() <- nil
+	}
+	<-ch.Out()
+}
+
+func BenchmarkResizableChannelTickTock(b *testing.B) {
+	ch := NewResizableChannel()
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+		<-ch.Out()
+	}
+}
+
+func BenchmarkResizableChannelShrinkDropNewest(b *testing.B) {
+	ch := NewResizableChannel()
+	for i := 0; i < b.N; i++ {
+		ch.Resize(Infinity)
+		for j := 0; j < 1000; j++ {
+			ch.In() <- j
+		}
+		for _ = range ch.ResizeWithPolicy(1, ShrinkDropNewest) {
+		}
+		<-ch.Out()
+	}
+	ch.Close()
+}
@@ -47,3 +47,56 @@ func TestRingChannel(t *testing.T) {
 	ch = NewRingChannel(2)
 	testChannelConcurrentAccessors(t, "ring channel", ch)
 }
+
+func TestRingChannelSpillover(t *testing.T) {
+	spill := NewInfiniteChannel()
+	ch := NewRingChannelWithSpillover(10, spill)
+	for i := 0; i < 1000; i++ {
+		ch.In() <- i
+	}
+	ch.Close()
+	for i := 990; i < 1000; i++ {
+		val := <-ch.Out()
+		if i != val.(int) {
+			t.Fatal("ring channel expected", i, "but got", val.(int))
+		}
+	}
+	spill.Close()
+	for i := 0; i < 990; i++ {
+		val := <-spill.Out()
+		if i != val.(int) {
+			t.Fatal("ring channel spilled", val.(int), "but expected", i)
+		}
+	}
+	if val, open := <-spill.Out(); open {
+		t.Fatal("ring channel spilled unexpected value", val)
+	}
+
+	spill = NewInfiniteChannel()
+	ch = NewRingChannelWithSpillover(None, spill)
+	ch.In() <- 0
+	ch.Close()
+	<-ch.Done()
+	spill.Close()
+	if val := <-spill.Out(); val != 0 {
+		t.Fatal("unbuffered ring channel spilled", val)
+	}
+}
+
+func BenchmarkRingChannelSerial(b *testing.B) {
+	ch := NewRingChannel(100)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+	}
+	ch.Close()
+	for _ = range ch.Out() {
+	}
+}
+
+func BenchmarkRingChannelTickTock(b *testing.B) {
+	ch := NewRingChannel(100)
+	for i := 0; i < b.N; i++ {
+		ch.In() <- nil
+		<-ch.Out()
+	}
+}
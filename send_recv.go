@@ -0,0 +1,141 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by Send when the channel has already been closed.
+var ErrClosed = errors.New("channels: send on closed channel")
+
+// Status describes the outcome of one of the non-blocking or time-limited send and receive helpers.
+type Status int
+
+const (
+	// Succeeded indicates the value was sent or received.
+	Succeeded Status = iota
+	// TimedOut indicates the channel was not ready before the operation gave up (immediately in the
+	// case of TrySend and TryRecv, or when the timeout elapsed or the context was done otherwise).
+	TimedOut
+	// Closed indicates the channel was closed; for sends this replaces the usual panic.
+	Closed
+)
+
+func (s Status) String() string {
+	switch s {
+	case Succeeded:
+		return "succeeded"
+	case TimedOut:
+		return "timed out"
+	case Closed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// recoverClosed converts the runtime panic from sending on a closed channel into a Closed status.
+func recoverClosed(status *Status) {
+	if r := recover(); r != nil {
+		if err, ok := r.(error); ok && err.Error() == "send on closed channel" {
+			*status = Closed
+			return
+		}
+		panic(r)
+	}
+}
+
+// TrySend writes val to the channel only if it can do so without blocking.
+func TrySend(ch SimpleInChannel, val interface{}) (status Status) {
+	defer recoverClosed(&status)
+	select {
+	case ch.In() <- val:
+		return Succeeded
+	default:
+		return TimedOut
+	}
+}
+
+// TryRecv reads a value from the channel only if one is available without blocking.
+func TryRecv(ch SimpleOutChannel) (interface{}, Status) {
+	select {
+	case val, open := <-ch.Out():
+		if !open {
+			return nil, Closed
+		}
+		return val, Succeeded
+	default:
+		return nil, TimedOut
+	}
+}
+
+// SendTimeout writes val to the channel, giving up if that has not happened within the timeout.
+func SendTimeout(ch SimpleInChannel, val interface{}, timeout time.Duration) (status Status) {
+	defer recoverClosed(&status)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ch.In() <- val:
+		return Succeeded
+	case <-timer.C:
+		return TimedOut
+	}
+}
+
+// RecvTimeout reads a value from the channel, giving up if none arrives within the timeout.
+func RecvTimeout(ch SimpleOutChannel, timeout time.Duration) (interface{}, Status) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case val, open := <-ch.Out():
+		if !open {
+			return nil, Closed
+		}
+		return val, Succeeded
+	case <-timer.C:
+		return nil, TimedOut
+	}
+}
+
+// SendCtx writes val to the channel, giving up (with TimedOut) if the context is done first.
+func SendCtx(ctx context.Context, ch SimpleInChannel, val interface{}) (status Status) {
+	defer recoverClosed(&status)
+	select {
+	case ch.In() <- val:
+		return Succeeded
+	case <-ctx.Done():
+		return TimedOut
+	}
+}
+
+// RecvCtx reads a value from the channel, giving up (with TimedOut) if the context is done first.
+func RecvCtx(ctx context.Context, ch SimpleOutChannel) (interface{}, Status) {
+	select {
+	case val, open := <-ch.Out():
+		if !open {
+			return nil, Closed
+		}
+		return val, Succeeded
+	case <-ctx.Done():
+		return nil, TimedOut
+	}
+}
+
+// Send writes val to the channel, blocking as long as necessary. Unlike writing to In() directly it does not
+// panic if the channel has been closed; it returns the error the channel was closed with (if the channel
+// implements ErrorCloser and was closed by CloseWithError) or ErrClosed.
+func Send(ch SimpleInChannel, val interface{}) error {
+	var status Status
+	func() {
+		defer recoverClosed(&status)
+		ch.In() <- val
+	}()
+	if status == Closed {
+		if ec, ok := ch.(ErrorCloser); ok && ec.Err() != nil {
+			return ec.Err()
+		}
+		return ErrClosed
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrySendRecv(t *testing.T) {
+	ch := NewNativeChannel(1)
+
+	if status := TrySend(ch, 1); status != Succeeded {
+		t.Error("first TrySend returned", status)
+	}
+	if status := TrySend(ch, 2); status != TimedOut {
+		t.Error("TrySend on full channel returned", status)
+	}
+	if val, status := TryRecv(ch); status != Succeeded || val.(int) != 1 {
+		t.Error("TryRecv returned", val, status)
+	}
+	if _, status := TryRecv(ch); status != TimedOut {
+		t.Error("TryRecv on empty channel returned", status)
+	}
+
+	ch.Close()
+	if status := TrySend(ch, 3); status != Closed {
+		t.Error("TrySend on closed channel returned", status)
+	}
+	if _, status := TryRecv(ch); status != Closed {
+		t.Error("TryRecv on closed channel returned", status)
+	}
+}
+
+func TestSendRecvTimeout(t *testing.T) {
+	ch := NewNativeChannel(None)
+
+	if status := SendTimeout(ch, 1, time.Millisecond); status != TimedOut {
+		t.Error("SendTimeout with no reader returned", status)
+	}
+	if _, status := RecvTimeout(ch, time.Millisecond); status != TimedOut {
+		t.Error("RecvTimeout with no writer returned", status)
+	}
+
+	go func() {
+		ch.In() <- 1
+	}()
+	if val, status := RecvTimeout(ch, time.Second); status != Succeeded || val.(int) != 1 {
+		t.Error("RecvTimeout returned", val, status)
+	}
+
+	go func() {
+		<-ch.Out()
+	}()
+	if status := SendTimeout(ch, 2, time.Second); status != Succeeded {
+		t.Error("SendTimeout returned", status)
+	}
+
+	ch.Close()
+	if status := SendTimeout(ch, 3, time.Second); status != Closed {
+		t.Error("SendTimeout on closed channel returned", status)
+	}
+	if _, status := RecvTimeout(ch, time.Second); status != Closed {
+		t.Error("RecvTimeout on closed channel returned", status)
+	}
+}
+
+func TestSendRecvCtx(t *testing.T) {
+	ch := NewInfiniteChannel()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if status := SendCtx(ctx, ch, 1); status != Succeeded {
+		t.Error("SendCtx returned", status)
+	}
+	if val, status := RecvCtx(ctx, ch); status != Succeeded || val.(int) != 1 {
+		t.Error("RecvCtx returned", val, status)
+	}
+
+	cancel()
+	if _, status := RecvCtx(ctx, ch); status != TimedOut {
+		t.Error("RecvCtx with cancelled context returned", status)
+	}
+
+	ch.Close()
+	if status := SendCtx(context.Background(), ch, 2); status != Closed {
+		t.Error("SendCtx on closed channel returned", status)
+	}
+	if _, status := RecvCtx(context.Background(), ch); status != Closed {
+		t.Error("RecvCtx on closed channel returned", status)
+	}
+}
+
+func TestSend(t *testing.T) {
+	ch := NewInfiniteChannel()
+
+	if err := Send(ch, 1); err != nil {
+		t.Error("Send returned", err)
+	}
+
+	ch.Close()
+	if err := Send(ch, 2); err != ErrClosed {
+		t.Error("Send on closed channel returned", err)
+	}
+
+	reason := errors.New("shutting down")
+	ch = NewInfiniteChannel()
+	ch.CloseWithError(reason)
+	if err := Send(ch, 3); err != reason {
+		t.Error("Send on channel closed with error returned", err)
+	}
+
+	native := NewNativeChannel(None)
+	native.Close()
+	if err := Send(native, 4); err != ErrClosed {
+		t.Error("Send on closed native channel returned", err)
+	}
+}
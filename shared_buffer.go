@@ -2,17 +2,19 @@ package channels
 
 import (
 	"reflect"
+	"sync"
 
 	"github.com/eapache/queue"
 )
 
-//sharedBufferChannel implements SimpleChannel and is created by the public
+//sharedBufferChannel implements SimpleChannel and ErrorCloser and is created by the public
 //SharedBuffer type below
 type sharedBufferChannel struct {
 	in     chan interface{}
 	out    chan interface{}
 	buf    *queue.Queue
-	closed bool
+	closed bool // only accessed from the SharedBuffer's goroutine
+	closer closeState
 }
 
 func (sch *sharedBufferChannel) In() chan<- interface{} {
@@ -24,7 +26,15 @@ func (sch *sharedBufferChannel) Out() <-chan interface{} {
 }
 
 func (sch *sharedBufferChannel) Close() {
-	close(sch.in)
+	sch.closer.close(sch.in, nil)
+}
+
+func (sch *sharedBufferChannel) CloseWithError(err error) {
+	sch.closer.close(sch.in, err)
+}
+
+func (sch *sharedBufferChannel) Err() error {
+	return sch.closer.error()
 }
 
 //SharedBuffer implements the Buffer interface, and permits multiple SimpleChannel instances to "share" a single buffer.
@@ -35,11 +45,13 @@ func (sch *sharedBufferChannel) Close() {
 //at any particular step.
 // Warning: this type has an unavoidable deadlock as implemented (see https://github.com/eapache/channels/issues/28).
 type SharedBuffer struct {
-	cases []reflect.SelectCase   // 2n+1 of these; [0] is for control, [1,3,5...] for recv, [2,4,6...] for send
-	chans []*sharedBufferChannel // n of these
-	count int
-	size  BufferCap
-	in    chan *sharedBufferChannel
+	length lengthGauge
+	cases  []reflect.SelectCase   // 2n+1 of these; [0] is for control, [1,3,5...] for recv, [2,4,6...] for send
+	chans  []*sharedBufferChannel // n of these
+	count  int
+	size   BufferCap
+	in     chan *sharedBufferChannel
+	once   sync.Once
 }
 
 func NewSharedBuffer(size BufferCap) *SharedBuffer {
@@ -79,7 +91,7 @@ func (buf *SharedBuffer) NewChannel() SimpleChannel {
 //the buffer (I'm not really sure what would happen if you do so).
 func (buf *SharedBuffer) Close() {
 	// TODO: what if there are still active channels using this buffer?
-	close(buf.in)
+	buf.once.Do(func() { close(buf.in) })
 }
 
 func (buf *SharedBuffer) mainLoop() {
@@ -156,11 +168,12 @@ func (buf *SharedBuffer) mainLoop() {
 				}
 			}
 		}
+		buf.length.set(buf.count)
 	}
 }
 
 func (buf *SharedBuffer) Len() int {
-	return buf.count
+	return buf.length.get()
 }
 
 func (buf *SharedBuffer) Cap() BufferCap {
@@ -1,6 +1,9 @@
 package channels
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestSharedBufferSingleton(t *testing.T) {
 	buf := NewSharedBuffer(3)
@@ -125,3 +128,27 @@ func ExampleSharedBuffer() {
 
 	buf.Close()
 }
+
+func TestSharedBufferCloseWithError(t *testing.T) {
+	buf := NewSharedBuffer(3)
+	ch := buf.NewChannel()
+	ch.In() <- 1
+
+	reason := errors.New("reason")
+	ec := ch.(ErrorCloser)
+	if ec.Err() != nil {
+		t.Error("shared buffer channel had error", ec.Err(), "while open")
+	}
+	ec.CloseWithError(reason)
+	ch.Close()
+	if val := <-ch.Out(); val != 1 {
+		t.Error("shared buffer channel delivered", val)
+	}
+	if _, open := <-ch.Out(); open {
+		t.Error("shared buffer channel still open")
+	}
+	if ec.Err() != reason {
+		t.Error("shared buffer channel expected error", reason, "but got", ec.Err())
+	}
+	buf.Close()
+}
@@ -0,0 +1,23 @@
+package channels
+
+// StackChannel implements the Channel interface with a last in, first out buffer: Out() always produces the
+// most recently written value which has not yet been read. Under overload this serves the newest values first,
+// which keeps their latency low at the expense of the older values.
+//
+// When the buffer is full, writers block if the overflow policy is Block; with DropOldest the value written
+// longest ago (the one at the bottom of the stack) is discarded instead. It is a PolicyChannel with a StackStorage.
+type StackChannel struct {
+	policyBuffer
+}
+
+// NewStackChannel creates a StackChannel with the given capacity (which may be Infinity) and overflow policy;
+// a nil policy is Block.
+func NewStackChannel(size BufferCap, overflow Policy) *StackChannel {
+	checkSize(size, "NewStackChannel")
+	if overflow == nil {
+		overflow = Block
+	}
+	ch := &StackChannel{}
+	ch.start(size, NewStackStorage(), overflow, nil)
+	return ch
+}
@@ -0,0 +1,53 @@
+package channels
+
+import "testing"
+
+func TestStackChannel(t *testing.T) {
+	var ch Channel
+
+	ch = NewStackChannel(Infinity, Block)
+	for i := 0; i < 1000; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "stack channel", ch, 1000)
+	ch.Close()
+	for i := 999; i >= 0; i-- {
+		val := <-ch.Out()
+		if i != val.(int) {
+			t.Fatal("stack channel expected", i, "but got", val.(int))
+		}
+	}
+	if val, open := <-ch.Out(); open == true {
+		t.Fatal("stack channel expected closed but got", val)
+	}
+
+	ch = NewStackChannel(10, DropOldest)
+	for i := 0; i < 1000; i++ {
+		ch.In() <- i
+	}
+	waitForLen(t, "stack channel", ch, 10)
+	ch.Close()
+	for i := 999; i >= 990; i-- {
+		val := <-ch.Out()
+		if i != val.(int) {
+			t.Fatal("stack channel expected", i, "but got", val.(int))
+		}
+	}
+
+	ch = NewStackChannel(2, nil)
+	for i := 0; i < 2; i++ {
+		ch.In() <- i
+	}
+	select {
+	case ch.In() <- 2:
+		t.Error("stack channel accepted a value when full")
+	default:
+	}
+	if val := <-ch.Out(); val != 1 {
+		t.Error("stack channel expected 1 but got", val)
+	}
+	ch.Close()
+
+	ch = NewStackChannel(5, nil)
+	testChannelConcurrentAccessors(t, "stack channel", ch)
+}
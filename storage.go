@@ -0,0 +1,419 @@
+package channels
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/eapache/queue"
+)
+
+// Storage holds the values buffered by a PolicyChannel and determines the order in which they are read.
+// A Storage is only ever used by the goroutine of the channel it belongs to, so implementations need not be
+// safe for concurrent use, and none of the methods which read or remove a value are called when it is empty.
+//
+// A Storage which can only hold a limited number of values, like RingStorage, should also have a method
+// Cap() BufferCap returning that limit; a PolicyChannel then refuses any capacity (or autoscaling bound)
+// above it, rather than leaving the storage to lose values behind the policy's back.
+type Storage interface {
+	// Len returns the number of values stored.
+	Len() int
+	// Add stores a value.
+	Add(elem interface{})
+	// Peek returns the value which will be read next.
+	Peek() interface{}
+	// Remove removes and returns the value which will be read next.
+	Remove() interface{}
+	// Evict removes and returns the i'th oldest value, where 0 <= i < Len(): the value at index i of Added().
+	Evict(i int) interface{}
+	// Values returns every stored value in the order in which they would be read.
+	Values() []interface{}
+	// Added returns every stored value in the order in which they were added, oldest first. For a first in,
+	// first out storage this is the same as Values.
+	Added() []interface{}
+}
+
+// newestEvicter is implemented by the storages which can remove several of their newest values at once more
+// cheaply than by calling Evict for each, so that shrinking a channel with ShrinkDropNewest isn't quadratic.
+type newestEvicter interface {
+	// evictNewest removes and returns the n newest values, oldest first, where 0 < n <= Len().
+	evictNewest(n int) []interface{}
+}
+
+// boundedStorage is implemented by the storages which can only hold a limited number of values.
+type boundedStorage interface {
+	Cap() BufferCap
+}
+
+// QueueStorage is a Storage which reads values in the order they were written (first in, first out).
+type QueueStorage struct {
+	q *queue.Queue
+}
+
+func NewQueueStorage() *QueueStorage {
+	return &QueueStorage{q: queue.New()}
+}
+
+func (s *QueueStorage) Len() int {
+	return s.q.Length()
+}
+
+func (s *QueueStorage) Add(elem interface{}) {
+	s.q.Add(elem)
+}
+
+func (s *QueueStorage) Peek() interface{} {
+	return s.q.Peek()
+}
+
+func (s *QueueStorage) Remove() interface{} {
+	return s.q.Remove()
+}
+
+// Evict takes constant time for the oldest value, but time proportional to Len() for any other.
+func (s *QueueStorage) Evict(i int) interface{} {
+	if i == 0 {
+		return s.q.Remove()
+	}
+	// the queue can only be removed from the front, so the remainder has to be copied
+	elem := s.q.Get(i)
+	remaining := queue.New()
+	for j := 0; j < s.q.Length(); j++ {
+		if j != i {
+			remaining.Add(s.q.Get(j))
+		}
+	}
+	s.q = remaining
+	return elem
+}
+
+func (s *QueueStorage) evictNewest(n int) []interface{} {
+	keep := s.q.Length() - n
+	evicted := make([]interface{}, n)
+	for i := range evicted {
+		evicted[i] = s.q.Get(keep + i)
+	}
+	remaining := queue.New()
+	for i := 0; i < keep; i++ {
+		remaining.Add(s.q.Get(i))
+	}
+	s.q = remaining
+	return evicted
+}
+
+func (s *QueueStorage) Values() []interface{} {
+	return queueContents(s.q)
+}
+
+func (s *QueueStorage) Added() []interface{} {
+	return s.Values()
+}
+
+// StackStorage is a Storage which reads the most recently written value first (last in, first out).
+type StackStorage struct {
+	elems []interface{}
+}
+
+func NewStackStorage() *StackStorage {
+	return &StackStorage{}
+}
+
+func (s *StackStorage) Len() int {
+	return len(s.elems)
+}
+
+func (s *StackStorage) Add(elem interface{}) {
+	s.elems = append(s.elems, elem)
+}
+
+func (s *StackStorage) Peek() interface{} {
+	return s.elems[len(s.elems)-1]
+}
+
+func (s *StackStorage) Remove() interface{} {
+	return s.Evict(len(s.elems) - 1)
+}
+
+// Evict takes time proportional to the number of values added after the one evicted.
+func (s *StackStorage) Evict(i int) interface{} {
+	elem := s.elems[i]
+	copy(s.elems[i:], s.elems[i+1:])
+	s.elems[len(s.elems)-1] = nil
+	s.elems = s.elems[:len(s.elems)-1]
+	return elem
+}
+
+func (s *StackStorage) Values() []interface{} {
+	if len(s.elems) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(s.elems))
+	for i, elem := range s.elems {
+		values[len(values)-1-i] = elem
+	}
+	return values
+}
+
+func (s *StackStorage) Added() []interface{} {
+	if len(s.elems) == 0 {
+		return nil
+	}
+	return append([]interface{}(nil), s.elems...)
+}
+
+// HeapStorage is a Storage which reads values in priority order: the next value read is always the least of
+// those stored, according to the function passed to NewHeapStorage. Equal values are read in the order they
+// were written.
+type HeapStorage struct {
+	items heapItems
+	byAge []*heapItem // in the order they were added, including some which have since been removed
+	dead  int         // how many of byAge have been removed
+	seq   uint64
+}
+
+type heapItem struct {
+	elem  interface{}
+	seq   uint64
+	index int // the item's position in the heap, or -1 once it has been removed
+}
+
+func itemLess(less func(a, b interface{}) bool, a, b *heapItem) bool {
+	if less(StoredValue(a.elem), StoredValue(b.elem)) {
+		return true
+	}
+	if less(StoredValue(b.elem), StoredValue(a.elem)) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+type heapItems struct {
+	less  func(a, b interface{}) bool
+	items []*heapItem
+}
+
+func (h *heapItems) Len() int {
+	return len(h.items)
+}
+
+func (h *heapItems) Less(i, j int) bool {
+	return itemLess(h.less, h.items[i], h.items[j])
+}
+
+func (h *heapItems) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *heapItems) Push(x interface{}) {
+	item := x.(*heapItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *heapItems) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items[len(h.items)-1] = nil
+	h.items = h.items[:len(h.items)-1]
+	last.index = -1
+	return last
+}
+
+// byPriority sorts a copy of the heap's items, leaving their heap indices alone.
+type byPriority struct {
+	less  func(a, b interface{}) bool
+	items []*heapItem
+}
+
+func (b byPriority) Len() int           { return len(b.items) }
+func (b byPriority) Less(i, j int) bool { return itemLess(b.less, b.items[i], b.items[j]) }
+func (b byPriority) Swap(i, j int)      { b.items[i], b.items[j] = b.items[j], b.items[i] }
+
+// NewHeapStorage creates a HeapStorage ordered by less, which must report whether a should be read before b.
+func NewHeapStorage(less func(a, b interface{}) bool) *HeapStorage {
+	return &HeapStorage{items: heapItems{less: less}}
+}
+
+func (s *HeapStorage) Len() int {
+	return s.items.Len()
+}
+
+func (s *HeapStorage) Add(elem interface{}) {
+	item := &heapItem{elem: elem, seq: s.seq}
+	heap.Push(&s.items, item)
+	s.byAge = append(s.byAge, item)
+	s.seq++
+}
+
+func (s *HeapStorage) Peek() interface{} {
+	return s.items.items[0].elem
+}
+
+func (s *HeapStorage) Remove() interface{} {
+	item := heap.Pop(&s.items).(*heapItem)
+	s.forget()
+	return item.elem
+}
+
+// Evict takes logarithmic time (amortized) for the oldest and newest values, but time proportional to Len()
+// for any other.
+func (s *HeapStorage) Evict(i int) interface{} {
+	item := s.byAgeAt(i)
+	heap.Remove(&s.items, item.index)
+	s.forget()
+	return item.elem
+}
+
+// byAgeAt returns the i'th oldest item still in the heap, searching from whichever end of byAge is nearer.
+func (s *HeapStorage) byAgeAt(i int) *heapItem {
+	if i < s.Len()/2 {
+		for _, item := range s.byAge {
+			if item.index >= 0 {
+				if i == 0 {
+					return item
+				}
+				i--
+			}
+		}
+	} else {
+		i = s.Len() - 1 - i
+		for j := len(s.byAge) - 1; j >= 0; j-- {
+			if item := s.byAge[j]; item.index >= 0 {
+				if i == 0 {
+					return item
+				}
+				i--
+			}
+		}
+	}
+	panic("channels: HeapStorage is corrupt")
+}
+
+// forget accounts for an item having been removed from the heap, tidying byAge up so that it stays in
+// proportion to the number of values stored.
+func (s *HeapStorage) forget() {
+	s.dead++
+	for len(s.byAge) > 0 && s.byAge[0].index < 0 {
+		s.byAge[0] = nil
+		s.byAge = s.byAge[1:]
+		s.dead--
+	}
+	for len(s.byAge) > 0 && s.byAge[len(s.byAge)-1].index < 0 {
+		s.byAge[len(s.byAge)-1] = nil
+		s.byAge = s.byAge[:len(s.byAge)-1]
+		s.dead--
+	}
+	if s.dead > len(s.byAge)/2 {
+		live := make([]*heapItem, 0, s.Len())
+		for _, item := range s.byAge {
+			if item.index >= 0 {
+				live = append(live, item)
+			}
+		}
+		s.byAge, s.dead = live, 0
+	}
+}
+
+func (s *HeapStorage) Values() []interface{} {
+	if s.Len() == 0 {
+		return nil
+	}
+	sorted := byPriority{less: s.items.less, items: append([]*heapItem(nil), s.items.items...)}
+	sort.Sort(sorted)
+	values := make([]interface{}, len(sorted.items))
+	for i, item := range sorted.items {
+		values[i] = item.elem
+	}
+	return values
+}
+
+func (s *HeapStorage) Added() []interface{} {
+	if s.Len() == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, s.Len())
+	for _, item := range s.byAge {
+		if item.index >= 0 {
+			values = append(values, item.elem)
+		}
+	}
+	return values
+}
+
+// RingStorage is a first in, first out Storage with a fixed number of slots, all of which are allocated up
+// front so that buffering values never allocates. A PolicyChannel using it can't be given a capacity larger than
+// the number of slots, and adding a value when every slot is taken panics.
+type RingStorage struct {
+	elems       []interface{}
+	head, count int
+}
+
+// NewRingStorage creates a RingStorage with the given number of slots. It panics if size is not positive.
+func NewRingStorage(size int) *RingStorage {
+	if size <= 0 {
+		panic("channels: invalid size in NewRingStorage")
+	}
+	return &RingStorage{elems: make([]interface{}, size)}
+}
+
+func (s *RingStorage) Len() int {
+	return s.count
+}
+
+// Cap returns the number of slots.
+func (s *RingStorage) Cap() BufferCap {
+	return BufferCap(len(s.elems))
+}
+
+func (s *RingStorage) Add(elem interface{}) {
+	if s.count == len(s.elems) {
+		panic("channels: RingStorage is full")
+	}
+	s.elems[(s.head+s.count)%len(s.elems)] = elem
+	s.count++
+}
+
+func (s *RingStorage) Peek() interface{} {
+	return s.elems[s.head]
+}
+
+func (s *RingStorage) Remove() interface{} {
+	return s.Evict(0)
+}
+
+// Evict takes time proportional to the number of values between the one evicted and the nearer end of the ring.
+func (s *RingStorage) Evict(i int) interface{} {
+	size := len(s.elems)
+	elem := s.elems[(s.head+i)%size]
+	if i < s.count/2 {
+		// close the gap by moving the older values up one slot
+		for j := i; j > 0; j-- {
+			s.elems[(s.head+j)%size] = s.elems[(s.head+j-1)%size]
+		}
+		s.elems[s.head] = nil
+		s.head = (s.head + 1) % size
+	} else {
+		// or the newer values down one
+		for j := i; j < s.count-1; j++ {
+			s.elems[(s.head+j)%size] = s.elems[(s.head+j+1)%size]
+		}
+		s.elems[(s.head+s.count-1)%size] = nil
+	}
+	s.count--
+	return elem
+}
+
+func (s *RingStorage) Added() []interface{} {
+	return s.Values()
+}
+
+func (s *RingStorage) Values() []interface{} {
+	if s.count == 0 {
+		return nil
+	}
+	values := make([]interface{}, s.count)
+	for i := range values {
+		values[i] = s.elems[(s.head+i)%len(s.elems)]
+	}
+	return values
+}
@@ -0,0 +1,133 @@
+package channels
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func testStorage(t *testing.T, name string, s Storage, order []int) {
+	if s.Len() != 0 || s.Values() != nil {
+		t.Error(name, "was not empty")
+	}
+	for i := 0; i < 5; i++ {
+		s.Add(i)
+	}
+	values := s.Values()
+	for i := range order {
+		if values[i] != order[i] {
+			t.Fatal(name, "expected values", order, "but got", values)
+		}
+	}
+	if s.Peek() != order[0] {
+		t.Error(name, "peeked", s.Peek())
+	}
+	for i, val := range s.Added() {
+		if val != i {
+			t.Fatal(name, "expected to have added values in order but got", s.Added())
+		}
+	}
+
+	// evicting the oldest and newest values doesn't disturb the order of the rest
+	if val := s.Evict(0); val != 0 {
+		t.Error(name, "evicted", val, "as the oldest value")
+	}
+	if val := s.Evict(s.Len() - 1); val != 4 {
+		t.Error(name, "evicted", val, "as the newest value")
+	}
+	for _, expected := range order {
+		if expected == 0 || expected == 4 {
+			continue
+		}
+		if val := s.Remove(); val != expected {
+			t.Error(name, "expected", expected, "but removed", val)
+		}
+	}
+	if s.Len() != 0 {
+		t.Error(name, "had length", s.Len(), "after removing everything")
+	}
+}
+
+func TestStorage(t *testing.T) {
+	testStorage(t, "queue storage", NewQueueStorage(), []int{0, 1, 2, 3, 4})
+	testStorage(t, "stack storage", NewStackStorage(), []int{4, 3, 2, 1, 0})
+	testStorage(t, "ring storage", NewRingStorage(5), []int{0, 1, 2, 3, 4})
+	testStorage(t, "heap storage", NewHeapStorage(func(a, b interface{}) bool {
+		// odd numbers first
+		return a.(int)%2 == 1 && b.(int)%2 == 0
+	}), []int{1, 3, 0, 2, 4})
+}
+
+func TestRingStorageWrap(t *testing.T) {
+	s := NewRingStorage(3)
+	for i := 0; i < 5; i++ {
+		if s.Len() == 3 {
+			s.Remove()
+		}
+		s.Add(i)
+	}
+	if values := s.Values(); len(values) != 3 || values[0] != 2 || values[2] != 4 {
+		t.Error("ring storage kept", values)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("adding to a full ring storage did not panic")
+		}
+		if values := s.Values(); len(values) != 3 || values[0] != 2 || values[2] != 4 {
+			t.Error("ring storage kept", values)
+		}
+	}()
+	s.Add(5)
+}
+
+func TestQueueStorageEvictNewest(t *testing.T) {
+	s := NewQueueStorage()
+	for i := 0; i < 5; i++ {
+		s.Add(i)
+	}
+	if evicted := s.evictNewest(2); !reflect.DeepEqual(evicted, []interface{}{3, 4}) {
+		t.Error("queue storage evicted", evicted)
+	}
+	if values := s.Values(); !reflect.DeepEqual(values, []interface{}{0, 1, 2}) {
+		t.Error("queue storage kept", values)
+	}
+}
+
+func TestHeapStorageEvict(t *testing.T) {
+	// check against a plain slice of the values in the order they were added
+	s := NewHeapStorage(intLess)
+	var added []interface{}
+	for i := 0; i < 2000; i++ {
+		switch op := rand.Intn(4); {
+		case op < 2 || len(added) == 0:
+			val := rand.Intn(100)
+			s.Add(val)
+			added = append(added, val)
+		case op == 2:
+			j := rand.Intn(len(added))
+			if val := s.Evict(j); val != added[j] {
+				t.Fatal("heap storage evicted", val, "but expected", added[j])
+			}
+			added = append(added[:j], added[j+1:]...)
+		default:
+			val := s.Remove()
+			for j := range added {
+				if added[j] == val {
+					added = append(added[:j], added[j+1:]...)
+					break
+				}
+			}
+		}
+		if !reflect.DeepEqual(s.Added(), added) && len(added) > 0 {
+			t.Fatal("heap storage has added", s.Added(), "but expected", added)
+		}
+	}
+
+	values := s.Values()
+	for i := 1; i < len(values); i++ {
+		if intLess(values[i], values[i-1]) {
+			t.Fatal("heap storage values out of order", values)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package channels
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Expiring may be implemented by values written to any of the PolicyChannel-based types (InfiniteChannel,
+// ResizableChannel, RingChannel, OverflowingChannel, StackChannel and PolicyChannel itself) to give each value
+// its own deadline. A value whose deadline has passed is discarded instead of being delivered on Out(), exactly
+// as if it had outlived the channel's TTL (see SetTTL). A zero time means the value never expires.
+type Expiring interface {
+	ExpiresAt() time.Time
+}
+
+// stamped wraps a buffered value with the time it was written, for channels which need to know how long
+// each value has been waiting.
+type stamped struct {
+	elem  interface{}
+	at    time.Time
+	timed bool // whether a TTL was set when the value was written
+}
+
+// StoredValue returns the value written to a channel given a value held in its Storage. Channels which need to
+// know how long their values have been buffered (for a TTL, say) store them wrapped along with the time they were
+// written, so a Storage which inspects its values (rather than just storing them) must pass them through
+// StoredValue first. Other values are returned unchanged.
+func StoredValue(stored interface{}) interface{} {
+	if s, ok := stored.(stamped); ok {
+		return s.elem
+	}
+	return stored
+}
+
+func storedValues(stored []interface{}) []interface{} {
+	if stored == nil {
+		return nil
+	}
+	// the Storage may have handed over its own slice, so the values are copied rather than unwrapped in place
+	values := make([]interface{}, len(stored))
+	for i := range stored {
+		values[i] = StoredValue(stored[i])
+	}
+	return values
+}
+
+// policyStorage presents a channel's Storage to its Policy with the values unwrapped.
+type policyStorage struct {
+	Storage
+}
+
+func (s policyStorage) Peek() interface{} {
+	return StoredValue(s.Storage.Peek())
+}
+
+func (s policyStorage) Remove() interface{} {
+	return StoredValue(s.Storage.Remove())
+}
+
+func (s policyStorage) Evict(i int) interface{} {
+	return StoredValue(s.Storage.Evict(i))
+}
+
+func (s policyStorage) Values() []interface{} {
+	return storedValues(s.Storage.Values())
+}
+
+func (s policyStorage) Added() []interface{} {
+	return storedValues(s.Storage.Added())
+}
+
+type ttlRequest struct {
+	ttl     time.Duration
+	expired SimpleInChannel
+}
+
+// SetTTL discards values which have been buffered for longer than ttl rather than delivering them on Out(). Values
+// are timed from when they are written, and only those written while a TTL is set are timed at all, so values
+// written before the TTL was set never expire by it; a ttl of 0 removes the TTL, after which values already
+// buffered no longer expire by it either. If expired is not nil, discarded values are written to it instead of
+// being lost, and as with a spillover channel the channel blocks until it accepts them. This applies equally to
+// values which implement Expiring, which expire at their own deadline whether or not a TTL is set.
+//
+// Values are only checked when they are about to be delivered, so Len() may count values which have expired
+// behind others which have not (this cannot happen in an InfiniteChannel, say, where the TTL is the same for
+// every value and the oldest value is always delivered first).
+func (ch *policyBuffer) SetTTL(ttl time.Duration, expired SimpleInChannel) {
+	if ttl < 0 {
+		panic("channels: invalid negative TTL")
+	}
+	select {
+	case ch.control <- ttlRequest{ttl: ttl, expired: expired}:
+	case <-ch.done:
+	}
+}
+
+// Expired returns the number of values which have been discarded because they expired.
+func (ch *policyBuffer) Expired() uint64 {
+	return atomic.LoadUint64(&ch.expiredCount)
+}
+
+// stamp wraps a value being buffered with the time it was written, if the channel needs to know it.
+func (ch *policyBuffer) stamp(elem interface{}) interface{} {
+	if ch.ttl > 0 || ch.codel != nil || ch.tracker() != nil {
+		return stamped{elem: elem, at: time.Now(), timed: ch.ttl > 0}
+	}
+	return elem
+}
+
+// expiry returns the time at which a buffered value expires, or the zero time if it does not.
+func (ch *policyBuffer) expiry(stored interface{}) time.Time {
+	var deadline time.Time
+	if s, ok := stored.(stamped); ok && s.timed && ch.ttl > 0 {
+		deadline = s.at.Add(ch.ttl)
+	}
+	if e, ok := StoredValue(stored).(Expiring); ok {
+		if at := e.ExpiresAt(); !at.IsZero() && (deadline.IsZero() || at.Before(deadline)) {
+			deadline = at
+		}
+	}
+	return deadline
+}
+
+// expiryTimer wakes a channel's goroutine when the value at the head of its buffer expires.
+type expiryTimer struct {
+	timer *time.Timer
+	at    time.Time
+}
+
+// arm returns a channel which fires at the deadline, or nil if the deadline is zero.
+func (t *expiryTimer) arm(deadline time.Time) <-chan time.Time {
+	if deadline.IsZero() {
+		return nil
+	}
+	if !deadline.Equal(t.at) {
+		// a stale expiry left in the channel by Reset just makes the goroutine check again
+		if t.timer == nil {
+			t.timer = time.NewTimer(deadline.Sub(time.Now()))
+		} else {
+			t.timer.Stop()
+			t.timer.Reset(deadline.Sub(time.Now()))
+		}
+		t.at = deadline
+	}
+	return t.timer.C
+}
+
+// fired must be called when the channel returned by arm fires.
+func (t *expiryTimer) fired() {
+	t.at = time.Time{}
+}
+
+func (t *expiryTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
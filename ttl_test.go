@@ -0,0 +1,114 @@
+package channels
+
+import (
+	"testing"
+	"time"
+)
+
+type expiringValue struct {
+	id       int
+	deadline time.Time
+}
+
+func (v expiringValue) ExpiresAt() time.Time {
+	return v.deadline
+}
+
+func TestTTL(t *testing.T) {
+	expired := NewInfiniteChannel()
+	ch := NewInfiniteChannel()
+	ch.SetTTL(10*time.Millisecond, expired)
+	for i := 0; i < 3; i++ {
+		ch.In() <- i
+	}
+	time.Sleep(20 * time.Millisecond)
+	ch.In() <- 3
+
+	if val := <-ch.Out(); val != 3 {
+		t.Error("channel with TTL delivered", val)
+	}
+	if ch.Expired() != 3 {
+		t.Error("channel with TTL expired", ch.Expired(), "values")
+	}
+	expired.Close()
+	for i := 0; i < 3; i++ {
+		if val := <-expired.Out(); val != i {
+			t.Error("channel with TTL reported", val, "expired but expected", i)
+		}
+	}
+
+	// once the TTL is removed, values already buffered no longer expire either
+	ch.In() <- 4
+	ch.SetTTL(0, nil)
+	time.Sleep(20 * time.Millisecond)
+	if val := <-ch.Out(); val != 4 {
+		t.Error("channel with TTL removed delivered", val)
+	}
+	ch.Close()
+}
+
+func TestTTLSetLater(t *testing.T) {
+	// values stamped for residence tracking before the TTL was set still never expire by it
+	ch := NewInfiniteChannel()
+	ch.SetResidenceTracking(true)
+	ch.In() <- 0
+	ch.SetTTL(time.Millisecond, nil)
+	time.Sleep(10 * time.Millisecond)
+	ch.In() <- 1
+	time.Sleep(10 * time.Millisecond)
+	ch.Close()
+	if val := <-ch.Out(); val != 0 {
+		t.Error("channel with TTL set later delivered", val)
+	}
+	if val, open := <-ch.Out(); open || ch.Expired() != 1 {
+		t.Error("channel with TTL set later delivered", val, "and expired", ch.Expired(), "values")
+	}
+}
+
+func TestStoredValuesCopies(t *testing.T) {
+	stored := []interface{}{stamped{elem: 1}, 2}
+	if values := storedValues(stored); values[0] != 1 || values[1] != 2 {
+		t.Error("stored values unwrapped to", values)
+	}
+	if _, ok := stored[0].(stamped); !ok {
+		t.Error("stored values were unwrapped in place", stored)
+	}
+}
+
+func TestTTLWhileWaiting(t *testing.T) {
+	// the value at the head expires while waiting for a reader, and must not be delivered afterwards
+	ch := NewRingChannel(5)
+	ch.SetTTL(10*time.Millisecond, nil)
+	ch.In() <- 0
+	waitForLen(t, "ring channel with TTL", ch, 1)
+	waitForLen(t, "ring channel with TTL", ch, 0)
+	if ch.Expired() != 1 {
+		t.Error("ring channel with TTL expired", ch.Expired(), "values")
+	}
+	ch.Close()
+	if val, open := <-ch.Out(); open {
+		t.Error("ring channel with TTL delivered", val)
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	ch := NewPolicyChannel(Infinity, NewHeapStorage(func(a, b interface{}) bool {
+		return a.(expiringValue).id < b.(expiringValue).id
+	}), Block, nil)
+	ch.SetTTL(time.Hour, nil)
+
+	now := time.Now()
+	ch.In() <- expiringValue{id: 2}
+	ch.In() <- expiringValue{id: 1, deadline: now.Add(-time.Second)}
+	ch.In() <- expiringValue{id: 3, deadline: now.Add(time.Hour)}
+	ch.Close()
+
+	for _, expected := range []int{2, 3} {
+		if val := <-ch.Out(); val.(expiringValue).id != expected {
+			t.Error("channel with expiring values delivered", val, "but expected", expected)
+		}
+	}
+	if ch.Expired() != 1 {
+		t.Error("channel with expiring values expired", ch.Expired(), "values")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build go1.18
+// +build go1.18
+
+package channels
+
+// WrapOf is a type-safe alternative to Wrap which does not use reflection. If ch already carries values of
+// type interface{} it is returned directly as a NativeOutChannel, with no extra goroutine or buffering
+// in between; otherwise a single goroutine converts each value as it is read, with the same unavoidable
+// buffer that Wrap adds.
+func WrapOf[T any](ch <-chan T) SimpleOutChannel {
+	if raw, ok := any(ch).(<-chan interface{}); ok {
+		return NativeOutChannel(raw)
+	}
+	realChan := make(chan interface{})
+
+	go func() {
+		for x := range ch {
+			realChan <- x
+		}
+		close(realChan)
+	}()
+
+	return NativeOutChannel(realChan)
+}
+
+// UnwrapTo is a type-safe alternative to Unwrap which does not use reflection. It pipes every value read
+// from input to output, and closes output once input is closed. Like Unwrap it adds an unavoidable buffer
+// around the input channel, and it panics if a value is received that is not of type T.
+func UnwrapTo[T any](input SimpleOutChannel, output chan<- T) {
+	go func() {
+		for x := range input.Out() {
+			output <- x.(T)
+		}
+		close(output)
+	}()
+}
@@ -0,0 +1,116 @@
+//go:build go1.18
+// +build go1.18
+
+package channels
+
+import "testing"
+
+func TestWrapOf(t *testing.T) {
+	rawChan := make(chan int, 5)
+	ch := WrapOf[int](rawChan)
+
+	for i := 0; i < 5; i++ {
+		rawChan <- i
+	}
+	close(rawChan)
+
+	for i := 0; i < 5; i++ {
+		x := (<-ch.Out()).(int)
+		if x != i {
+			t.Error("Wrapped value", x, "was expecting", i)
+		}
+	}
+	_, ok := <-ch.Out()
+	if ok {
+		t.Error("Wrapped channel didn't close")
+	}
+
+	nativeChan := make(chan interface{}, 5)
+	if _, ok := WrapOf[interface{}](nativeChan).(NativeOutChannel); !ok {
+		t.Error("Wrapping a native channel didn't return it directly")
+	}
+	nativeChan <- 1
+	if x := <-WrapOf[interface{}](nativeChan).Out(); x.(int) != 1 {
+		t.Error("Wrapped native channel returned", x)
+	}
+}
+
+func TestUnwrapTo(t *testing.T) {
+	rawChan := make(chan int)
+	ch := NewNativeChannel(5)
+	UnwrapTo[int](ch, rawChan)
+
+	for i := 0; i < 5; i++ {
+		ch.In() <- i
+	}
+	ch.Close()
+
+	for i := 0; i < 5; i++ {
+		x := <-rawChan
+		if x != i {
+			t.Error("Unwrapped value", x, "was expecting", i)
+		}
+	}
+	_, ok := <-rawChan
+	if ok {
+		t.Error("Unwrapped channel didn't close")
+	}
+}
+
+func BenchmarkWrap(b *testing.B) {
+	rawChan := make(chan int)
+	ch := Wrap(rawChan)
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			rawChan <- i
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-ch.Out()
+	}
+}
+
+func BenchmarkWrapOf(b *testing.B) {
+	rawChan := make(chan int)
+	ch := WrapOf[int](rawChan)
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			rawChan <- i
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-ch.Out()
+	}
+}
+
+func BenchmarkUnwrap(b *testing.B) {
+	rawChan := make(chan int)
+	ch := NewNativeChannel(None)
+	Unwrap(ch, rawChan)
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-rawChan
+	}
+}
+
+func BenchmarkUnwrapTo(b *testing.B) {
+	rawChan := make(chan int)
+	ch := NewNativeChannel(None)
+	UnwrapTo[int](ch, rawChan)
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-rawChan
+	}
+}
@@ -0,0 +1,107 @@
+package channels
+
+import (
+	"sync"
+	"time"
+)
+
+// Stall describes a stage which a Watchdog has found to be stalled.
+type Stall struct {
+	ChannelInfo
+	Since time.Time // when the stage's length or read count last changed
+}
+
+// Watchdog watches everything in a Registry for stages which have stopped making progress, such as the
+// deadlocks which SharedBuffer is prone to, or a cycle of stages each waiting on the next. A stage is stalled once
+// it has held values for the whole threshold without its length changing or anything being read from it.
+//
+// Empty stages are never stalled, however long they sit idle, and unbuffered channels and the helper functions
+// are always empty, so it is the buffers upstream of a blocked goroutine which get reported. For types which don't
+// count what is read from them (NativeChannel and SharedBuffer) only the length is watched, so a steady stream
+// which keeps the length exactly constant is mistaken for a stall; in practice the length fluctuates.
+type Watchdog struct {
+	registry  *Registry
+	threshold time.Duration
+	onStall   func([]Stall)
+	watched   map[string]*watchedStage
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+type watchedStage struct {
+	len     int
+	read    uint64
+	since   time.Time
+	stalled bool
+}
+
+// NewWatchdog starts a Watchdog over the given registry, checking several times per threshold for stalled
+// stages. Each time it finds some it calls onStall (on the watchdog's own goroutine) with those that have stalled
+// since the last call; a stage is not reported again until it has made progress and then stalled once more.
+// It panics if the threshold is not positive.
+func NewWatchdog(reg *Registry, threshold time.Duration, onStall func([]Stall)) *Watchdog {
+	if threshold <= 0 {
+		panic("channels: invalid threshold in NewWatchdog")
+	}
+	w := &Watchdog{
+		registry:  reg,
+		threshold: threshold,
+		onStall:   onStall,
+		watched:   make(map[string]*watchedStage),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Stop stops the watchdog, waiting for any call to onStall in progress to return, so it must not be called
+// from onStall itself.
+func (w *Watchdog) Stop() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+func (w *Watchdog) run() {
+	interval := w.threshold / 4
+	if interval <= 0 {
+		interval = w.threshold
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(w.done)
+	for {
+		select {
+		case now := <-ticker.C:
+			if stalls := w.check(now); len(stalls) > 0 {
+				w.onStall(stalls)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *Watchdog) check(now time.Time) []Stall {
+	var stalls []Stall
+	seen := make(map[string]bool, len(w.watched))
+	for _, info := range w.registry.Channels() {
+		seen[info.Name] = true
+		stage := w.watched[info.Name]
+		if stage == nil || stage.len != info.Len || stage.read != info.Read {
+			w.watched[info.Name] = &watchedStage{len: info.Len, read: info.Read, since: now}
+			continue
+		}
+		if info.Len > 0 && !stage.stalled && now.Sub(stage.since) >= w.threshold {
+			stage.stalled = true
+			stalls = append(stalls, Stall{ChannelInfo: info, Since: stage.since})
+		}
+	}
+	for name := range w.watched {
+		if !seen[name] {
+			delete(w.watched, name)
+		}
+	}
+	return stalls
+}
@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	reg := NewRegistry()
+	stuck := NewInfiniteChannel()
+	stuck.In() <- 1
+	busy := NewInfiniteChannel()
+	reg.Register("stuck", stuck)
+	reg.Register("busy", busy)
+	reg.Register("idle", NewInfiniteChannel())
+
+	stop := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case busy.In() <- i:
+				<-busy.Out()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer close(stop)
+
+	reports := make(chan []Stall, 10)
+	w := NewWatchdog(reg, 20*time.Millisecond, func(stalls []Stall) {
+		reports <- stalls
+	})
+	defer w.Stop()
+
+	var stalls []Stall
+	select {
+	case stalls = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("stall not reported")
+	}
+	if len(stalls) != 1 || stalls[0].Name != "stuck" || stalls[0].Len != 1 {
+		t.Fatal("unexpected stalls", stalls)
+	}
+	if time.Now().Sub(stalls[0].Since) < 20*time.Millisecond {
+		t.Error("stall reported too early", stalls[0].Since)
+	}
+
+	// no further reports until the stage makes progress and stalls again
+	select {
+	case stalls = <-reports:
+		t.Fatal("stall reported twice", stalls)
+	case <-time.After(60 * time.Millisecond):
+	}
+	stuck.In() <- 2
+	select {
+	case stalls = <-reports:
+		if stalls[0].Name != "stuck" || stalls[0].Len != 2 {
+			t.Error("unexpected stalls", stalls)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second stall not reported")
+	}
+}
+
+func TestWatchdogStop(t *testing.T) {
+	reg := NewRegistry()
+	ch := NewInfiniteChannel()
+	ch.In() <- 1
+	reg.Register("ch", ch)
+
+	w := NewWatchdog(reg, time.Millisecond, func([]Stall) {})
+	w.Stop()
+	w.Stop()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("zero threshold did not panic")
+		}
+	}()
+	NewWatchdog(reg, 0, nil)
+}